@@ -0,0 +1,95 @@
+// Command backfill-summaries queues weekly summaries for past weeks. The
+// running server's summary workers pick the tasks up, and each summary is
+// saved under the week it was queued for.
+//
+//	go run ./cmd/backfill-summaries -from 2025-01-06 -to 2025-03-31 [-user 42] [-skip-existing]
+package main
+
+import (
+	"context"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"daily-150/routines"
+	"flag"
+	"log"
+	"time"
+)
+
+func main() {
+	from := flag.String("from", "", "first week to summarise, as any date in it (YYYY-MM-DD)")
+	to := flag.String("to", "", "last week to summarise, as any date in it (YYYY-MM-DD); defaults to the last week that has ended")
+	userID := flag.Uint("user", 0, "only summarise this user's weeks")
+	skipExisting := flag.Bool("skip-existing", false, "leave out weeks a user already has a summary for")
+	flag.Parse()
+
+	if *from == "" {
+		log.Fatalln("-from is required")
+	}
+	fromDate, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatalln("Invalid -from date. Please use YYYY-MM-DD format")
+	}
+	fromWeek := models.WeekStart(fromDate)
+
+	var toDate time.Time
+	if *to != "" {
+		toDate, err = time.Parse("2006-01-02", *to)
+		if err != nil {
+			log.Fatalln("Invalid -to date. Please use YYYY-MM-DD format")
+		}
+	}
+
+	initialisers.LoadEnv()
+	initialisers.ConnectDB()
+	initialisers.InitRedis()
+	if initialisers.RedisClient == nil {
+		log.Fatalln("Redis client not initialised")
+	}
+
+	// Only weeks that are over can be summarised, and a week ends at a
+	// different time in each user's time zone.
+	lastWeeks, err := routines.LastWeekStarts(time.Now())
+	if err != nil {
+		log.Fatalln("Error reading users' time zones:", err)
+	}
+	var lastWeek time.Time
+	for week := range lastWeeks {
+		if week.After(lastWeek) {
+			lastWeek = week
+		}
+	}
+
+	toWeek := lastWeek
+	if *to != "" {
+		toWeek = models.WeekStart(toDate)
+	}
+	if toWeek.After(lastWeek) {
+		log.Fatalln("-to must not be in the current week or later")
+	}
+	if toWeek.Before(fromWeek) {
+		log.Fatalln("-from must not be after -to")
+	}
+
+	ctx := context.Background()
+	total := 0
+	for week := fromWeek; !week.After(toWeek); week = week.AddDate(0, 0, 7) {
+		// Zones where this week is not over yet are left out.
+		var zones []string
+		for last, lastZones := range lastWeeks {
+			if !week.After(last) {
+				zones = append(zones, lastZones...)
+			}
+		}
+
+		queued, err := routines.EnqueueWeekSummaries(ctx, week, zones, *userID, *skipExisting)
+		if err != nil {
+			log.Fatalf("Error queueing summaries for the week of %s: %v\n", week.Format("2006-01-02"), err)
+		}
+
+		year, number := week.ISOWeek()
+		log.Printf("Queued %d summaries for %d-W%02d (week of %s)\n", queued, year, number, week.Format("2006-01-02"))
+		total += queued
+	}
+
+	log.Printf("Queued %d summaries in total\n", total)
+}
@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxAttachmentNameLength = 255
+
+var (
+	errAttachmentQuota    = errors.New("attachment quota exceeded")
+	errAttachmentTooLarge = errors.New("attachment too large")
+	errNoAttachmentFile   = errors.New("no attachment file")
+)
+
+// Only these types are shown in the browser; anything else is always downloaded.
+var inlineContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type AttachmentResponse struct {
+	ID          uint   `json:"ID"`
+	EntryID     uint   `json:"entry_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func newAttachmentResponse(attachment models.Attachment, name string) AttachmentResponse {
+	return AttachmentResponse{
+		ID:          attachment.ID,
+		EntryID:     attachment.JournalEntryID,
+		Name:        name,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		CreatedAt:   attachment.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func attachmentUsage(db *gorm.DB, userID uint) (int64, error) {
+	var used int64
+	err := db.Model(&models.Attachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+func attachmentUsageResponse(used int64) fiber.Map {
+	return fiber.Map{
+		"used":  used,
+		"quota": helper.AttachmentQuota(),
+	}
+}
+
+func newStorageKey(userID uint) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", userID, hex.EncodeToString(random)), nil
+}
+
+func attachmentName(filename string) string {
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(filename, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if utf8.RuneCountInString(name) > maxAttachmentNameLength {
+		name = string([]rune(name)[:maxAttachmentNameLength])
+	}
+	return name
+}
+
+// readUploadedFile reads the multipart "file" field straight off the streamed
+// request body, so the upload is never buffered whole next to the file and
+// reading stops as soon as the file grows past maxSize. Anything after the file
+// is left for middlewares.LimitBody to discard.
+func readUploadedFile(c *fiber.Ctx, maxSize int64) (string, []byte, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return "", nil, errNoAttachmentFile
+	}
+
+	stream := c.Context().RequestBodyStream()
+	if stream == nil {
+		stream = bytes.NewReader(c.Body())
+	}
+	body := &io.LimitedReader{R: stream, N: helper.MaxAttachmentRequestSize()}
+
+	reader := multipart.NewReader(body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", nil, errNoAttachmentFile
+		}
+		if err != nil {
+			if body.N == 0 {
+				return "", nil, errAttachmentTooLarge
+			}
+			return "", nil, err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if int64(len(data)) > maxSize || (err != nil && body.N == 0) {
+			return "", nil, errAttachmentTooLarge
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return part.FileName(), data, nil
+	}
+}
+
+// UploadAttachment attaches the multipart "file" field to an entry. The file is
+// encrypted before it reaches the blob store.
+func UploadAttachment(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to update this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	maxSize := helper.MaxAttachmentSize()
+	filename, data, err := readUploadedFile(c, maxSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, errNoAttachmentFile):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A file is required",
+			})
+		case errors.Is(err, errAttachmentTooLarge):
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": fmt.Sprintf("Attachments can be at most %d MB", maxSize>>20),
+			})
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to read file",
+			})
+		}
+	}
+	if len(data) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "File is empty",
+		})
+	}
+
+	name := attachmentName(filename)
+
+	encryptedName, err := models.Encrypt(name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process attachment",
+		})
+	}
+
+	encryptedData, err := models.EncryptBytes(data)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process attachment",
+		})
+	}
+
+	storageKey, err := newStorageKey(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process attachment",
+		})
+	}
+
+	ctx := context.Background()
+	if err := initialisers.BlobStore.Put(ctx, storageKey, encryptedData); err != nil {
+		log.Println("Error storing attachment:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store attachment",
+		})
+	}
+
+	attachment := models.Attachment{
+		UserID:         user.ID,
+		JournalEntryID: entry.ID,
+		EncryptedName:  encryptedName,
+		// The type is sniffed from the content rather than taken from the client.
+		ContentType: http.DetectContentType(data),
+		Size:        int64(len(data)),
+		StorageKey:  storageKey,
+	}
+
+	// Locking the user row keeps two uploads at once from both fitting under the quota.
+	var used int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.User{}, user.ID).Error; err != nil {
+			return err
+		}
+
+		used, err = attachmentUsage(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if used+attachment.Size > helper.AttachmentQuota() {
+			return errAttachmentQuota
+		}
+
+		return tx.Create(&attachment).Error
+	})
+
+	if err != nil {
+		if deleteErr := initialisers.BlobStore.Delete(ctx, storageKey); deleteErr != nil {
+			log.Println("Error removing unused attachment:", deleteErr)
+		}
+
+		if errors.Is(err, errAttachmentQuota) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "Attachment storage quota exceeded",
+				"usage": attachmentUsageResponse(used),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save attachment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":    "Attachment uploaded successfully",
+		"attachment": newAttachmentResponse(attachment, name),
+		"usage":      attachmentUsageResponse(used + attachment.Size),
+	})
+}
+
+func GetEntryAttachments(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to view this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var attachments []models.Attachment
+	if err := db.Where("journal_entry_id = ?", entry.ID).Order("id ASC").Find(&attachments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving attachments",
+		})
+	}
+
+	used, err := attachmentUsage(db, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving attachments",
+		})
+	}
+
+	// Attachments whose names cannot be decrypted are left out rather than failing the whole response.
+	response := make([]AttachmentResponse, 0, len(attachments))
+	for _, attachment := range attachments {
+		name, err := models.Decrypt(attachment.EncryptedName)
+		if err != nil {
+			continue
+		}
+		response = append(response, newAttachmentResponse(attachment, name))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"attachments": response,
+		"usage":       attachmentUsageResponse(used),
+	})
+}
+
+// findUserAttachment looks up one of the user's attachments on an entry that is not in the trash.
+func findUserAttachment(userID uint, id string) (models.Attachment, error) {
+	db := initialisers.DB
+
+	var attachment models.Attachment
+	err := db.Where("id = ? AND user_id = ?", id, userID).
+		Where("journal_entry_id IN (?)", db.Model(&models.JournalEntry{}).Select("id").Where("user_id = ?", userID)).
+		First(&attachment).Error
+	return attachment, err
+}
+
+func DownloadAttachment(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	attachment, err := findUserAttachment(user.ID, c.Params("id"))
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	encryptedData, err := initialisers.BlobStore.Get(context.Background(), attachment.StorageKey)
+	if err != nil {
+		log.Println("Error loading attachment:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error loading attachment",
+		})
+	}
+
+	data, err := models.DecryptBytes(encryptedData)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting attachment",
+		})
+	}
+
+	name, err := models.Decrypt(attachment.EncryptedName)
+	if err != nil {
+		name = "attachment"
+	}
+
+	disposition := "attachment"
+	if inlineContentTypes[attachment.ContentType] {
+		disposition = "inline"
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Status(fiber.StatusOK).Send(data)
+}
+
+func DeleteAttachment(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	attachment, err := findUserAttachment(user.ID, c.Params("id"))
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if err := initialisers.BlobStore.Delete(context.Background(), attachment.StorageKey); err != nil {
+		log.Println("Error deleting attachment from blob store:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete attachment",
+		})
+	}
+
+	if err := db.Unscoped().Delete(&attachment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete attachment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Attachment deleted successfully",
+	})
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxCalendarDays = 366
+
+type CalendarDay struct {
+	Date       string `json:"date"`
+	HasEntry   bool   `json:"has_entry"`
+	EntryID    uint   `json:"entry_id,omitempty"`
+	EntryCount int    `json:"entry_count"`
+	WordCount  int    `json:"word_count"`
+	WordGoal   int    `json:"word_goal"`
+	GoalMet    bool   `json:"goal_met"`
+}
+
+// GetCalendar returns one item per day between from and to (inclusive) without
+// touching entry content, so the client can draw a heatmap cheaply. A day may
+// have an entry in several notebooks: entry_id points at the default notebook's
+// entry when there is one, and word_count only adds up notebooks that count
+// toward the goal.
+func GetCalendar(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	to, ok, err := helper.ParseDateQuery(c, "to")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid to date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("to"),
+		})
+	}
+	if !ok {
+		to = user.Today()
+	}
+
+	from, ok, err := helper.ParseDateQuery(c, "from")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid from date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("from"),
+		})
+	}
+	if !ok {
+		from = to.AddDate(0, 0, -(maxCalendarDays - 1))
+	}
+
+	if to.Before(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from must not be after to",
+		})
+	}
+
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Date range cannot be longer than 366 days",
+		})
+	}
+
+	var entries []models.JournalEntry
+	if err := db.Select("id", "notebook_id", "entry_date", "word_count").
+		Where("user_id = ? AND entry_date BETWEEN ? AND ?", user.ID, from, to).
+		Order("id ASC").
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving entries",
+		})
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	defaultNotebook, err := models.DefaultNotebook(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	goalNotebooks, err := goalNotebookIDs(user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	calendarDays := make(map[string]*CalendarDay, len(entries))
+	for _, entry := range entries {
+		key := entry.EntryDate.Format("2006-01-02")
+		calendarDay, ok := calendarDays[key]
+		if !ok {
+			calendarDay = &CalendarDay{HasEntry: true, EntryID: entry.ID}
+			calendarDays[key] = calendarDay
+		}
+
+		calendarDay.EntryCount++
+		if entry.NotebookID == defaultNotebook.ID {
+			calendarDay.EntryID = entry.ID
+		}
+		if goalNotebooks[entry.NotebookID] {
+			calendarDay.WordCount += entry.WordCount
+		}
+	}
+
+	days := make([]CalendarDay, 0, int(to.Sub(from).Hours()/24)+1)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		calendarDay := CalendarDay{}
+		if written, ok := calendarDays[key]; ok {
+			calendarDay = *written
+		}
+
+		calendarDay.Date = key
+		calendarDay.WordGoal = wordGoals.On(day)
+		calendarDay.GoalMet = calendarDay.HasEntry && calendarDay.WordCount >= calendarDay.WordGoal
+
+		days = append(days, calendarDay)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		"days": days,
+	})
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DraftResponse struct {
+	NotebookID uint   `json:"notebook_id"`
+	Date       string `json:"date"`
+	Content    string `json:"content"`
+	WordCount  int    `json:"word_count"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// What is kept in Redis for a draft. The content is encrypted just like in Postgres.
+type cachedDraft struct {
+	EncryptedContent string    `json:"encrypted_content"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func draftCacheKey(userID uint, notebookID uint, date time.Time) string {
+	return fmt.Sprintf("daily-150:draft:%d:%d:%s", userID, notebookID, date.Format("2006-01-02"))
+}
+
+var errInvalidNotebookID = errors.New("invalid notebook ID")
+
+// draftNotebook returns the notebook named by ?notebook=, or the user's default
+// notebook when the query leaves it out.
+func draftNotebook(c *fiber.Ctx, userID uint) (models.Notebook, error) {
+	if c.Query("notebook") == "" {
+		return findUserNotebook(userID, nil)
+	}
+
+	notebookID, err := strconv.ParseUint(c.Query("notebook"), 10, 64)
+	if err != nil {
+		return models.Notebook{}, errInvalidNotebookID
+	}
+	id := uint(notebookID)
+	return findUserNotebook(userID, &id)
+}
+
+func draftNotebookErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errInvalidNotebookID):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "notebook must be a notebook ID",
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Notebook does not exist",
+		})
+	default:
+		return helper.HandleError(c, err)
+	}
+}
+
+// saveDraft writes the draft to Redis and mirrors it to Postgres, so an
+// evicted or flushed cache never loses a day's writing.
+func saveDraft(userID uint, notebookID uint, date time.Time, content string) (models.Draft, error) {
+	db := initialisers.DB
+
+	encryptedContent, err := models.Encrypt(content)
+	if err != nil {
+		return models.Draft{}, err
+	}
+
+	draft := models.Draft{
+		UserID:           userID,
+		NotebookID:       notebookID,
+		DraftDate:        date,
+		EncryptedContent: encryptedContent,
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "notebook_id"}, {Name: "draft_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"encrypted_content", "updated_at"}),
+	}).Create(&draft).Error; err != nil {
+		return models.Draft{}, err
+	}
+
+	cacheDraft(draft)
+	return draft, nil
+}
+
+func cacheDraft(draft models.Draft) {
+	ctx := context.Background()
+	draftJSON, err := json.Marshal(cachedDraft{
+		EncryptedContent: draft.EncryptedContent,
+		UpdatedAt:        draft.UpdatedAt,
+	})
+	if err != nil {
+		return
+	}
+
+	if err := initialisers.RedisClient.Set(ctx, draftCacheKey(draft.UserID, draft.NotebookID, draft.DraftDate), draftJSON, models.DraftTTL).Err(); err != nil {
+		log.Println("Error saving draft to cache:", err)
+	}
+}
+
+// loadDraft returns gorm.ErrRecordNotFound when there is no draft for the day in the notebook.
+func loadDraft(userID uint, notebookID uint, date time.Time) (models.Draft, error) {
+	ctx := context.Background()
+
+	if result, err := initialisers.RedisClient.Get(ctx, draftCacheKey(userID, notebookID, date)).Result(); err == nil {
+		var cached cachedDraft
+		if err := json.Unmarshal([]byte(result), &cached); err == nil {
+			draft := models.Draft{
+				UserID:           userID,
+				NotebookID:       notebookID,
+				DraftDate:        date,
+				EncryptedContent: cached.EncryptedContent,
+			}
+			draft.UpdatedAt = cached.UpdatedAt
+			return draft, nil
+		}
+	}
+
+	var draft models.Draft
+	if err := initialisers.DB.
+		Where("user_id = ? AND notebook_id = ? AND draft_date = ?", userID, notebookID, date).
+		Where("updated_at > ?", time.Now().Add(-models.DraftTTL)).
+		First(&draft).Error; err != nil {
+		return models.Draft{}, err
+	}
+
+	cacheDraft(draft)
+	return draft, nil
+}
+
+func clearDraft(userID uint, notebookID uint, date time.Time) error {
+	ctx := context.Background()
+
+	if err := initialisers.RedisClient.Del(ctx, draftCacheKey(userID, notebookID, date)).Err(); err != nil {
+		log.Println("Error deleting draft from cache:", err)
+	}
+
+	return initialisers.DB.Unscoped().Where("user_id = ? AND notebook_id = ? AND draft_date = ?", userID, notebookID, date).Delete(&models.Draft{}).Error
+}
+
+func newDraftResponse(draft models.Draft, content string) DraftResponse {
+	return DraftResponse{
+		NotebookID: draft.NotebookID,
+		Date:       draft.DraftDate.Format("2006-01-02"),
+		Content:    content,
+		WordCount:  helper.CountWords(content),
+		UpdatedAt:  draft.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func SaveDraft(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	date, err := time.Parse("2006-01-02", c.Params("date"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Params("date"),
+		})
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if body.Content == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Content is required",
+		})
+	}
+
+	if entryContentTooLong(body.Content) {
+		return entryTooLongResponse(c)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	notebook, err := draftNotebook(c, user.ID)
+	if err != nil {
+		return draftNotebookErrorResponse(c, err)
+	}
+
+	draft, err := saveDraft(user.ID, notebook.ID, date, body.Content)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save draft",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Draft saved",
+		"draft":   newDraftResponse(draft, body.Content),
+	})
+}
+
+func GetDraft(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	date, err := time.Parse("2006-01-02", c.Params("date"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Params("date"),
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	notebook, err := draftNotebook(c, user.ID)
+	if err != nil {
+		return draftNotebookErrorResponse(c, err)
+	}
+
+	draft, err := loadDraft(user.ID, notebook.ID, date)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	decryptedContent, err := models.Decrypt(draft.EncryptedContent)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting draft",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"draft": newDraftResponse(draft, decryptedContent),
+	})
+}
+
+func DeleteDraft(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	date, err := time.Parse("2006-01-02", c.Params("date"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Params("date"),
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	notebook, err := draftNotebook(c, user.ID)
+	if err != nil {
+		return draftNotebookErrorResponse(c, err)
+	}
+
+	if err := clearDraft(user.ID, notebook.ID, date); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting draft",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Draft deleted",
+	})
+}
+
+// Used by CreateEntry when the request carries no content of its own.
+func loadDraftContent(userID uint, notebookID uint, date time.Time) (string, error) {
+	draft, err := loadDraft(userID, notebookID, date)
+	if err != nil {
+		return "", err
+	}
+	return models.Decrypt(draft.EncryptedContent)
+}
@@ -71,8 +71,7 @@ func DidUserJournalToday(c *fiber.Ctx) error {
 
 	//Check cache
 	ctx := context.Background()
-	currentDate := time.Now().UTC().Format("2006-01-02")
-	redisKey := fmt.Sprintf("daily-150:journal-today:%s:%d", currentDate, user.ID)
+	redisKey := journaledTodayKey(user)
 	if result, err := redis.Get(ctx, redisKey).Result(); err == nil {
 		log.Println("Serving from cache")
 		if result == "true" {
@@ -88,12 +87,20 @@ func DidUserJournalToday(c *fiber.Ctx) error {
 		}
 	}
 
-	var entries []models.JournalEntry
-	if err := db.Where("user_id = ? AND DATE(date) = CURRENT_DATE", user.ID).Find(&entries).Error; err != nil {
+	today := user.Today()
+	wordGoal, err := models.WordGoalOn(db, user.ID, today)
+	if err != nil {
 		return helper.HandleError(c, err)
 	}
 
-	if len(entries) > 0 {
+	// "Today" is the user's local calendar day, not the server's. Words from every
+	// notebook that counts toward the goal add up.
+	words, err := models.GoalWordsOn(db, user.ID, today)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if words >= wordGoal {
 
 		//We had a cache miss so update the cache
 		_, err := redis.Set(ctx, redisKey, "true", 24*time.Hour).Result()
@@ -121,3 +128,8 @@ func DidUserJournalToday(c *fiber.Ctx) error {
 		"message": "You have not journaled today",
 	})
 }
+
+func journaledTodayKey(user models.User) string {
+	currentDate := user.Today().Format("2006-01-02")
+	return fmt.Sprintf("daily-150:journal-today:%s:%d", currentDate, user.ID)
+}
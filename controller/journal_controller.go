@@ -5,19 +5,301 @@ import (
 	"daily-150/helper"
 	"daily-150/initialisers"
 	"daily-150/models"
+	"daily-150/routines"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+type EntryResponse struct {
+	ID         uint          `json:"ID"`
+	UserID     uint          `json:"user_id"`
+	NotebookID uint          `json:"notebook_id"`
+	Date       string        `json:"date"`
+	Content    string        `json:"content"`
+	WordCount  int           `json:"word_count"`
+	WordGoal   int           `json:"word_goal"`
+	GoalMet    bool          `json:"goal_met"`
+	Version    uint          `json:"version"`
+	Tags       []TagResponse `json:"tags"`
+	Mood       *int          `json:"mood"`
+	Energy     *int          `json:"energy"`
+	PromptID   *uint         `json:"prompt_id"`
+	CreatedAt  string        `json:"created_at"`
+	UpdatedAt  string        `json:"updated_at"`
+}
+
+func newEntryResponse(entry models.JournalEntry, content string, wordGoal int) EntryResponse {
+	return EntryResponse{
+		ID:         entry.ID,
+		UserID:     entry.UserID,
+		NotebookID: entry.NotebookID,
+		Date:       entry.EntryDate.Format("2006-01-02"),
+		Content:    content,
+		WordCount:  entry.WordCount,
+		WordGoal:   wordGoal,
+		GoalMet:    entry.WordCount >= wordGoal,
+		Version:    entry.Version,
+		Tags:       newTagResponses(entry.Tags),
+		Mood:       entry.Mood,
+		Energy:     entry.Energy,
+		PromptID:   entry.PromptID,
+		CreatedAt:  entry.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:  entry.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+const (
+	defaultEntriesPageSize = 20
+	maxEntriesPageSize     = 100
+	maxEntryContentLength  = 100000
+)
+
+// Long entries are refused before they reach the word counter and the markdown renderer.
+func entryContentTooLong(content string) bool {
+	return utf8.RuneCountInString(content) > maxEntryContentLength
+}
+
+func entryTooLongResponse(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"error": "Content must be at most 100000 characters long",
+	})
+}
+
+// entryCursor points at the last entry of a page, ordered by (entry_date, id).
+type entryCursor struct {
+	Date time.Time `json:"date"`
+	ID   uint      `json:"id"`
+}
+
+func encodeEntryCursor(cursor entryCursor) string {
+	cursorJSON, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+func decodeEntryCursor(encoded string) (entryCursor, error) {
+	var cursor entryCursor
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(cursorJSON, &cursor)
+	return cursor, err
+}
+
+// parseEntryDate accepts either a calendar date or an RFC3339 timestamp, which
+// is converted to the calendar day it falls on in loc.
+func parseEntryDate(value string, loc *time.Location) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+
+	parsedDate, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return models.CalendarDate(parsedDate, loc), nil
+}
+
+var errVersionConflict = errors.New("entry was changed by another request")
+
+// The ETag of an entry is its version counter, bumped on every write.
+func entryETag(entry models.JournalEntry) string {
+	return fmt.Sprintf(`"%d"`, entry.Version)
+}
+
+// ifMatchAllows reports whether the request's If-Match header permits writing
+// over entry. Requests without the header keep the old last-write-wins behaviour.
+// If-Match uses the strong comparison, so a weak tag such as W/"3" never matches.
+func ifMatchAllows(c *fiber.Ctx, entry models.JournalEntry) bool {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == entryETag(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryChanges are the parts of an entry an update replaces. Nil fields are
+// left as they are, and a Mood or Energy of 0 clears the rating. Content is the
+// plain text of EncryptedContent, used for the word count and the search index.
+type entryChanges struct {
+	EncryptedContent *string
+	Content          string
+	Mood             *int
+	Energy           *int
+	Tags             *[]models.Tag
+}
+
+func (changes entryChanges) empty() bool {
+	return changes.EncryptedContent == nil && changes.Mood == nil && changes.Energy == nil && changes.Tags == nil
+}
+
+// ratingOrNil turns a rating from a request into the stored one, where 0 means none.
+func ratingOrNil(rating int) *int {
+	if rating == 0 {
+		return nil
+	}
+	return &rating
+}
+
+// writeEntry applies changes to the entry and bumps its version in one
+// transaction, as long as the entry is still at the version it was read at.
+// Replaced content is kept as a revision. On success entry holds the new
+// values and version.
+func writeEntry(entry *models.JournalEntry, changes entryChanges) error {
+	columns := map[string]interface{}{
+		"version": gorm.Expr("version + 1"),
+	}
+
+	wordCount := entry.WordCount
+	if changes.EncryptedContent != nil {
+		wordCount = helper.CountWords(changes.Content)
+		columns["encrypted_content"] = *changes.EncryptedContent
+		columns["word_count"] = wordCount
+	}
+
+	for column, rating := range map[string]*int{"mood": changes.Mood, "energy": changes.Energy} {
+		if rating == nil {
+			continue
+		}
+		if *rating == 0 {
+			columns[column] = nil
+		} else {
+			columns[column] = *rating
+		}
+	}
+
+	return initialisers.DB.Transaction(func(tx *gorm.DB) error {
+		// The version-checked update goes first: it locks the row, so a
+		// concurrent write waits for this one and then finds the version moved.
+		result := tx.Model(&models.JournalEntry{}).
+			Where("id = ? AND version = ?", entry.ID, entry.Version).
+			Updates(columns)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+
+		if changes.EncryptedContent != nil {
+			// entry still holds the content as it was read, before the update.
+			if err := saveEntryRevision(tx, *entry); err != nil {
+				return err
+			}
+			if err := indexEntry(tx, *entry, changes.Content); err != nil {
+				return err
+			}
+		}
+
+		if changes.Tags != nil {
+			if err := tx.Model(entry).Association("Tags").Replace(*changes.Tags); err != nil {
+				return err
+			}
+			entry.Tags = *changes.Tags
+		}
+
+		if changes.EncryptedContent != nil {
+			entry.EncryptedContent = *changes.EncryptedContent
+			entry.WordCount = wordCount
+		}
+		if changes.Mood != nil {
+			entry.Mood = ratingOrNil(*changes.Mood)
+		}
+		if changes.Energy != nil {
+			entry.Energy = ratingOrNil(*changes.Energy)
+		}
+		entry.Version++
+		return nil
+	})
+}
+
+// versionConflictResponse sends the entry as it is now on the server so the
+// client can resolve the conflict.
+func versionConflictResponse(c *fiber.Ctx, entryID uint, userID uint) error {
+	db := initialisers.DB
+
+	var current models.JournalEntry
+	if err := db.Preload("Tags").Where("id = ? AND user_id = ?", entryID, userID).First(&current).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	decryptedContent, err := models.Decrypt(current.EncryptedContent)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting content",
+		})
+	}
+
+	wordGoal, err := models.WordGoalOn(db, userID, current.EntryDate)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, entryETag(current))
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":           "Entry has been changed since it was loaded",
+		"current_version": current.Version,
+		"entry":           newEntryResponse(current, decryptedContent, wordGoal),
+	})
+}
+
+// moodRatingValid checks a mood or energy rating from a request. Leaving it out
+// is always fine; 0 is accepted only where it means clearing the rating.
+func moodRatingValid(rating *int, allowClear bool) bool {
+	if rating == nil || (allowClear && *rating == 0) {
+		return true
+	}
+	return *rating >= models.MinMoodRating && *rating <= models.MaxMoodRating
+}
+
+func invalidMoodResponse(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": fmt.Sprintf("mood and energy must be between %d and %d", models.MinMoodRating, models.MaxMoodRating),
+	})
+}
+
+// Entries are stored as markdown. contentFormat reads ?format=, which can ask
+// for sanitised HTML or plain text instead, and returns the matching converter.
+func contentFormat(c *fiber.Ctx) (string, func(string) string, bool) {
+	format := c.Query("format", "markdown")
+	switch format {
+	case "markdown":
+		return format, func(content string) string { return content }, true
+	case "html":
+		return format, helper.MarkdownToHTML, true
+	case "text":
+		return format, helper.MarkdownToText, true
+	}
+	return "", nil, false
+}
+
+// Entries changed, so cached status checks and stats have to go back to the database.
+func clearUserCaches(user models.User) error {
+	ctx := context.Background()
+	return initialisers.RedisClient.Del(ctx, journaledTodayKey(user), statsCacheKey(user)).Err()
+}
+
 func CreateEntry(c *fiber.Ctx) error {
 	db := initialisers.DB
 	username, ok := helper.GetUsername(c)
-	redis := initialisers.RedisClient
 
 	if !ok {
 		return helper.HandleError(c, fiber.ErrUnauthorized)
@@ -26,6 +308,15 @@ func CreateEntry(c *fiber.Ctx) error {
 	type RequestBody struct {
 		Date    string `json:"date"`
 		Content string `json:"content"`
+		TagIDs  []uint `json:"tag_ids"`
+		Mood    *int   `json:"mood"`
+		Energy  *int   `json:"energy"`
+		// The prompt the entry was written for, if any.
+		PromptID *uint `json:"prompt_id"`
+		// Used for the content when the request has none of its own.
+		TemplateID *uint `json:"template_id"`
+		// Entries go to the default notebook unless another is given.
+		NotebookID *uint `json:"notebook_id"`
 	}
 
 	var body RequestBody
@@ -35,7 +326,11 @@ func CreateEntry(c *fiber.Ctx) error {
 		})
 	}
 
-	if body.Content == "" || body.Date == "" {
+	if !moodRatingValid(body.Mood, false) || !moodRatingValid(body.Energy, false) {
+		return invalidMoodResponse(c)
+	}
+
+	if body.Date == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Both date and content are required",
 		})
@@ -46,14 +341,61 @@ func CreateEntry(c *fiber.Ctx) error {
 		return helper.HandleError(c, err)
 	}
 
-	parsedDate, err := time.Parse(time.RFC3339, body.Date)
+	entryDate, err := parseEntryDate(body.Date, user.Location())
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":        "Invalid date format. Please use RFC3339 format",
+			"error":        "Invalid date format. Please use RFC3339 or YYYY-MM-DD format",
 			"receivedDate": body.Date,
 		})
 	}
 
+	notebook, err := findUserNotebook(user.ID, body.NotebookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Notebook does not exist",
+			})
+		}
+		return helper.HandleError(c, err)
+	}
+
+	// Without content of its own, the entry is created from the template if one
+	// was given, and otherwise commits the autosaved draft for the day and notebook.
+	if body.Content == "" && body.TemplateID != nil {
+		var template models.Template
+		if err := db.Where("id = ? AND user_id = ?", *body.TemplateID, user.ID).First(&template).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Template does not exist",
+			})
+		}
+
+		content, promptID, err := renderTemplate(user, template, entryDate, true)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error rendering template",
+			})
+		}
+
+		body.Content = content
+		if body.PromptID == nil {
+			body.PromptID = promptID
+		}
+	}
+
+	if body.Content == "" {
+		draftContent, err := loadDraftContent(user.ID, notebook.ID, entryDate)
+		if err != nil || draftContent == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Both date and content are required",
+			})
+		}
+		body.Content = draftContent
+	}
+
+	if entryContentTooLong(body.Content) {
+		return entryTooLongResponse(c)
+	}
+
 	encryptedContent, err := models.Encrypt(body.Content)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -61,55 +403,78 @@ func CreateEntry(c *fiber.Ctx) error {
 		})
 	}
 
+	tags, err := findUserTags(user.ID, body.TagIDs)
+	if err != nil {
+		return unknownTagResponse(c, err)
+	}
+
+	if body.PromptID != nil {
+		if err := db.First(&models.Prompt{}, *body.PromptID).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Prompt does not exist",
+			})
+		}
+	}
+
 	var existingEntry models.JournalEntry
-	if err := db.Where("user_id = ? AND date = ?", user.ID, parsedDate).First(&existingEntry).Error; err == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Entry for this date already exists",
-		})
+	if err := db.Where("user_id = ? AND notebook_id = ? AND entry_date = ?", user.ID, notebook.ID, entryDate).First(&existingEntry).Error; err == nil {
+		return entryExistsResponse(c, existingEntry)
 	}
 
 	newEntry := models.JournalEntry{
 		UserID:           user.ID,
-		Date:             parsedDate,
+		NotebookID:       notebook.ID,
+		Date:             models.StartOfDay(entryDate, user.Location()),
+		EntryDate:        entryDate,
 		EncryptedContent: encryptedContent,
+		WordCount:        helper.CountWords(body.Content),
+		Tags:             tags,
+		Mood:             body.Mood,
+		Energy:           body.Energy,
+		PromptID:         body.PromptID,
 	}
 
-	if err := db.Create(&newEntry).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newEntry).Error; err != nil {
+			return err
+		}
+		return indexEntry(tx, newEntry, body.Content)
+	})
+
+	if err != nil {
+		// A concurrent request may have won the race for the unique (user_id, notebook_id, entry_date) index.
+		if err := db.Where("user_id = ? AND notebook_id = ? AND entry_date = ?", user.ID, notebook.ID, entryDate).First(&existingEntry).Error; err == nil {
+			return entryExistsResponse(c, existingEntry)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create entry",
 		})
 	}
 
-	type EntryResponse struct {
-		ID        uint   `json:"ID"`
-		UserID    uint   `json:"user_id"`
-		Date      string `json:"date"`
-		Content   string `json:"content"`
-		CreatedAt string `json:"created_at"`
+	if err := clearUserCaches(user); err != nil {
+		log.Println("Error clearing cache:", err)
 	}
 
-	response := EntryResponse{
-		ID:        newEntry.ID,
-		UserID:    newEntry.UserID,
-		Date:      newEntry.Date.Format("2006-01-02"),
-		Content:   body.Content,
-		CreatedAt: newEntry.CreatedAt.Format("2006-01-02 15:04:05"),
+	if err := clearDraft(user.ID, notebook.ID, entryDate); err != nil {
+		log.Println("Error clearing draft:", err)
 	}
 
-	ctx := context.Background()
-	currentDate := time.Now().UTC().Format("2006-01-02")
-	redisKey := fmt.Sprintf("daily-150:journal-today:%s:%d", currentDate, newEntry.UserID)
-
-	_, err = redis.Set(ctx, redisKey, "true", 24*time.Hour).Result()
+	wordGoal, err := models.WordGoalOn(db, user.ID, newEntry.EntryDate)
 	if err != nil {
-		log.Println("Error saving to cache:", err)
+		return helper.HandleError(c, err)
 	}
 
-	log.Println("Saved in cache")
-
+	c.Set(fiber.HeaderETag, entryETag(newEntry))
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Entry created successfully",
-		"entry":   response,
+		"entry":   newEntryResponse(newEntry, body.Content, wordGoal),
+	})
+}
+
+func entryExistsResponse(c *fiber.Ctx, existingEntry models.JournalEntry) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":             "Entry for this date already exists in this notebook",
+		"existing_entry_id": existingEntry.ID,
 	})
 }
 
@@ -152,16 +517,8 @@ func DeleteEntry(c *fiber.Ctx) error {
 		})
 	}
 
-	ctx := context.Background()
-	redis := initialisers.RedisClient
-	currentDate := time.Now().UTC().Format("2006-01-02")
-	redisKey := fmt.Sprintf("daily-150:journal-today:%s:%d", currentDate, entry.UserID)
-	_, err = redis.Set(ctx, redisKey, "false", 24*time.Hour).Result()
-	if err != nil {
-		log.Println("Error deleting from cache:", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error deleting from cache",
-		})
+	if err := clearUserCaches(user); err != nil {
+		log.Println("Error clearing cache:", err)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -198,8 +555,12 @@ func UpdateEntry(c *fiber.Ctx) error {
 		})
 	}
 
+	// Fields left out of the request are not changed; a mood or energy of 0 clears it.
 	type UpdateEntryRequest struct {
-		Content string `json:"content"`
+		Content *string `json:"content"`
+		TagIDs  *[]uint `json:"tag_ids"`
+		Mood    *int    `json:"mood"`
+		Energy  *int    `json:"energy"`
 	}
 
 	var updateEntryRequest UpdateEntryRequest
@@ -209,27 +570,86 @@ func UpdateEntry(c *fiber.Ctx) error {
 		})
 	}
 
-	plainContent := updateEntryRequest.Content
-	encryptedContent, err := models.Encrypt(updateEntryRequest.Content)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error encrypting content",
-		})
+	if !moodRatingValid(updateEntryRequest.Mood, true) || !moodRatingValid(updateEntryRequest.Energy, true) {
+		return invalidMoodResponse(c)
+	}
+
+	if updateEntryRequest.Content != nil && entryContentTooLong(*updateEntryRequest.Content) {
+		return entryTooLongResponse(c)
 	}
 
-	entry.EncryptedContent = encryptedContent
+	if !ifMatchAllows(c, entry) {
+		return versionConflictResponse(c, entry.ID, user.ID)
+	}
 
-	if err := db.Save(&entry).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error updating entry",
-		})
+	var tags []models.Tag
+	if updateEntryRequest.TagIDs != nil {
+		var err error
+		tags, err = findUserTags(user.ID, *updateEntryRequest.TagIDs)
+		if err != nil {
+			return unknownTagResponse(c, err)
+		}
+	}
+
+	changes := entryChanges{
+		Mood:   updateEntryRequest.Mood,
+		Energy: updateEntryRequest.Energy,
+	}
+	if updateEntryRequest.TagIDs != nil {
+		changes.Tags = &tags
 	}
 
-	entry.EncryptedContent = plainContent
+	var plainContent string
+	if updateEntryRequest.Content != nil {
+		plainContent = *updateEntryRequest.Content
+		encryptedContent, err := models.Encrypt(plainContent)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error encrypting content",
+			})
+		}
+		changes.EncryptedContent = &encryptedContent
+		changes.Content = plainContent
+	} else {
+		decryptedContent, err := models.Decrypt(entry.EncryptedContent)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decrypting content",
+			})
+		}
+		plainContent = decryptedContent
+	}
 
+	if !changes.empty() {
+		if err := writeEntry(&entry, changes); err != nil {
+			if errors.Is(err, errVersionConflict) {
+				return versionConflictResponse(c, entry.ID, user.ID)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating entry",
+			})
+		}
+	}
+
+	if changes.Tags == nil {
+		if err := db.Model(&entry).Association("Tags").Find(&entry.Tags); err != nil {
+			return helper.HandleError(c, err)
+		}
+	}
+
+	if err := clearUserCaches(user); err != nil {
+		log.Println("Error clearing cache:", err)
+	}
+
+	wordGoal, err := models.WordGoalOn(db, user.ID, entry.EntryDate)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, entryETag(entry))
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Entry updated successfully",
-		"entry":   entry,
+		"entry":   newEntryResponse(entry, plainContent, wordGoal),
 	})
 }
 
@@ -248,8 +668,15 @@ func GetEntryByID(c *fiber.Ctx) error {
 		return helper.HandleError(c, err)
 	}
 
+	format, formatContent, ok := contentFormat(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be markdown, html or text",
+		})
+	}
+
 	var entry models.JournalEntry
-	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+	if err := db.Preload("Tags").Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
 		return helper.HandleError(c, err)
 	}
 
@@ -260,26 +687,15 @@ func GetEntryByID(c *fiber.Ctx) error {
 		})
 	}
 
-	type EntryResponse struct {
-		ID        uint   `json:"ID"`
-		UserID    uint   `json:"user_id"`
-		Date      string `json:"date"`
-		Content   string `json:"content"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
-	}
-
-	response := EntryResponse{
-		ID:        entry.ID,
-		UserID:    entry.UserID,
-		Date:      entry.Date.Format("2006-01-02"),
-		Content:   decryptedContent,
-		CreatedAt: entry.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt: entry.UpdatedAt.Format("2006-01-02 15:04:05"),
+	wordGoal, err := models.WordGoalOn(db, user.ID, entry.EntryDate)
+	if err != nil {
+		return helper.HandleError(c, err)
 	}
 
+	c.Set(fiber.HeaderETag, entryETag(entry))
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"entry": response,
+		"entry":  newEntryResponse(entry, formatContent(decryptedContent), wordGoal),
+		"format": format,
 	})
 }
 
@@ -296,20 +712,104 @@ func GetAllEntries(c *fiber.Ctx) error {
 		return helper.HandleError(c, err)
 	}
 
+	limit := c.QueryInt("limit", defaultEntriesPageSize)
+	if limit < 1 || limit > maxEntriesPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("limit must be between 1 and %d", maxEntriesPageSize),
+		})
+	}
+
+	sortOrder := c.Query("sort", "desc")
+	if sortOrder != "asc" && sortOrder != "desc" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort must be either asc or desc",
+		})
+	}
+
+	format, formatContent, ok := contentFormat(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be markdown, html or text",
+		})
+	}
+
+	query := db.Where("user_id = ?", user.ID)
+
+	from, ok, err := helper.ParseDateQuery(c, "from")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid from date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("from"),
+		})
+	}
+	if ok {
+		query = query.Where("entry_date >= ?", from)
+	}
+
+	to, ok, err := helper.ParseDateQuery(c, "to")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid to date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("to"),
+		})
+	}
+	if ok {
+		query = query.Where("entry_date <= ?", to)
+	}
+
+	if c.Query("tag") != "" {
+		tagID, err := strconv.ParseUint(c.Query("tag"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "tag must be a tag ID",
+			})
+		}
+		query = query.Where("id IN (SELECT journal_entry_id FROM entry_tags WHERE tag_id = ?)", tagID)
+	}
+
+	if c.Query("notebook") != "" {
+		notebookID, err := strconv.ParseUint(c.Query("notebook"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "notebook must be a notebook ID",
+			})
+		}
+		query = query.Where("notebook_id = ?", notebookID)
+	}
+
+	if c.Query("cursor") != "" {
+		cursor, err := decodeEntryCursor(c.Query("cursor"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+
+		if sortOrder == "asc" {
+			query = query.Where("(entry_date, id) > (?, ?)", cursor.Date, cursor.ID)
+		} else {
+			query = query.Where("(entry_date, id) < (?, ?)", cursor.Date, cursor.ID)
+		}
+	}
+
+	// Fetch one extra row to find out whether there is another page.
 	var entries []models.JournalEntry
-	if err := db.Where("user_id = ?", user.ID).Find(&entries).Error; err != nil {
+	if err := query.Preload("Tags").Order("entry_date " + sortOrder).Order("id " + sortOrder).Limit(limit + 1).Find(&entries).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error retrieving entries",
 		})
 	}
 
-	type EntryResponse struct {
-		ID        uint   `json:"ID"`
-		UserID    uint   `json:"user_id"`
-		Date      string `json:"date"`
-		Content   string `json:"content"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
+	var nextCursor string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[len(entries)-1]
+		nextCursor = encodeEntryCursor(entryCursor{Date: last.EntryDate, ID: last.ID})
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
 	}
 
 	decryptedEntries := make([]EntryResponse, 0, len(entries))
@@ -320,25 +820,18 @@ func GetAllEntries(c *fiber.Ctx) error {
 			continue
 		}
 
-		decryptedEntry := EntryResponse{
-			ID:        entry.ID,
-			UserID:    entry.UserID,
-			Date:      entry.Date.Format("2006-01-02"),
-			Content:   decryptedContent,
-			CreatedAt: entry.CreatedAt.Format("2006-01-02 15:04:05"),
-			UpdatedAt: entry.UpdatedAt.Format("2006-01-02 15:04:05"),
-		}
-		decryptedEntries = append(decryptedEntries, decryptedEntry)
+		decryptedEntries = append(decryptedEntries, newEntryResponse(entry, formatContent(decryptedContent), wordGoals.On(entry.EntryDate)))
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Entries fetched successfully",
-		"entries": decryptedEntries,
+		"message":     "Entries fetched successfully",
+		"entries":     decryptedEntries,
+		"next_cursor": nextCursor,
+		"format":      format,
 	})
 }
 
 func GenerateWeeklySummary(c *fiber.Ctx) error {
-	db := initialisers.DB
 	redisClient := initialisers.RedisClient
 
 	if redisClient == nil {
@@ -347,16 +840,6 @@ func GenerateWeeklySummary(c *fiber.Ctx) error {
 		})
 	}
 
-	now := time.Now().UTC()
-
-	mostRecentMonday := now.AddDate(0, 0, -int(now.Weekday())+1)
-	if now.Weekday() == time.Sunday {
-		mostRecentMonday = now.AddDate(0, 0, -6)
-	}
-
-	startOfWeek := mostRecentMonday.AddDate(0, 0, -7)
-	endOfWeek := startOfWeek.AddDate(0, 0, 7)
-
 	CRON_ACTIVATION_KEY := os.Getenv("CRON_ACTIVATION_KEY")
 
 	RECEIVED_CRON_ACTIVATION_KEY := c.Get("x-api-key")
@@ -368,124 +851,24 @@ func GenerateWeeklySummary(c *fiber.Ctx) error {
 		})
 	}
 
-	var entries []models.JournalEntry
-	if err := db.Where("date BETWEEN ? AND ?", startOfWeek, endOfWeek).Find(&entries).Error; err != nil {
+	// Each user is summarised for the last week that has ended in their own
+	// time zone. Users who already have that summary are skipped, so a trigger
+	// that runs before a zone's week is over only queues it on the next run.
+	weeks, err := routines.LastWeekStarts(time.Now())
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving entries",
+			"error": "Error queueing summaries",
 		})
 	}
 
-	log.Println("GOT THESE MANY ENTRIES: ", len(entries))
-	log.Println("DECRYPTING ENTRIES")
-
-	userEntries := make(map[uint][]string)
-	for _, entry := range entries {
-		decryptedContent, err := models.Decrypt(entry.EncryptedContent)
-
-		if err != nil {
-			continue
+	for week, zones := range weeks {
+		if _, err := routines.EnqueueWeekSummaries(context.Background(), week, zones, 0, true); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error queueing summaries",
+			})
 		}
-
-		userEntries[entry.UserID] = append(userEntries[entry.UserID], decryptedContent)
 	}
 
-	ctx := context.Background()
-	queueName := "summary_tasks"
-	taskCount := 0
-
-	for userID, entries := range userEntries {
-		task := models.SummaryTask{
-			UserID:  userID,
-			Entries: entries,
-		}
-
-		taskJSON, err := json.Marshal(task)
-		if err != nil {
-			log.Println("Error marshalling task: ", err)
-			continue
-		}
-
-		log.Println("PUSHING TASK INTO QUEUE ")
-
-		if err := redisClient.RPush(ctx, queueName, taskJSON).Err(); err != nil {
-			log.Println("Error pushing task to Redis queue: ", err)
-			continue
-		}
-		taskCount++
-
-	}
-
-	// expressServerURL := os.Getenv("SUMMARY_SERVICE_URL")
-	// payload, err := json.Marshal(userEntries)
-	// if err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Error marshalling payload",
-	// 	})
-	// }
-
-	// SUMMARISER_KEY := os.Getenv("SUMMARISER_KEY")
-
-	// req, err := http.NewRequest("POST", expressServerURL, bytes.NewBuffer(payload))
-	// if err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Error creating request",
-	// 	})
-	// }
-
-	// req.Header.Set("Content-Type", "application/json")
-	// req.Header.Set("x-api-key", SUMMARISER_KEY)
-
-	// client := &http.Client{}
-	// resp, err := client.Do(req)
-	// if err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Error sending data to Express server" + err.Error(),
-	// 	})
-	// }
-	// defer resp.Body.Close()
-
-	// var result map[uint]string
-	// if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Error decoding response from Express server",
-	// 	})
-	// }
-
-	previousWeek := now.AddDate(0, 0, -7)
-	year, week := previousWeek.ISOWeek()
-	batchInfoJSON, _ := json.Marshal(map[string]interface{}{
-		"year":      year,
-		"week":      week,
-		"taskCount": taskCount,
-		"timestamp": now.Format(time.RFC3339),
-	})
-
-	log.Println("SETTING REDIS BATCH INFO")
-	redisClient.Set(ctx, fmt.Sprintf("batch:%d:%d", year, week), batchInfoJSON, 30*24*time.Hour)
-
-	// for userID, summary := range result {
-	// 	encryptedSummary, err := models.Encrypt(summary)
-	// 	if err != nil {
-	// 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 			"error": "Error encrypting summary",
-	// 		})
-	// 	}
-	// 	newSummary := models.Summary{
-	// 		UserID:     userID,
-	// 		WeekNumber: uint(week),
-	// 		Year:       uint(year),
-	// 		Summary:    encryptedSummary,
-	// 	}
-	// 	if err := db.Clauses(clause.OnConflict{
-	// 		Columns:   []clause.Column{{Name: "user_id"}, {Name: "week_number"}, {Name: "year"}}, // Conflict target (unique constraint)
-	// 		DoUpdates: clause.AssignmentColumns([]string{"summary"}),                             // Update the "summary" column on conflict
-	// 	}).Create(&newSummary).Error; err != nil {
-	// 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 			"error": "Error saving summary",
-	// 		})
-	// 	}
-	// }
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Summary Request Queued.",
 	})
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MemoryResponse struct {
+	YearsAgo int           `json:"years_ago"`
+	Entry    EntryResponse `json:"entry"`
+}
+
+// monthsBefore goes back n calendar months, landing on the last day of the
+// month when it is shorter, so a month before 31 March is 28 or 29 February.
+func monthsBefore(date time.Time, n int) time.Time {
+	year, month, day := date.Date()
+	firstOfMonth := time.Date(year, month-time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return firstOfMonth.AddDate(0, 0, min(day, lastDay)-1)
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// GetMemoriesToday returns what the user wrote on today's date in earlier
+// years. include=month,six_months also returns the default notebook's entries
+// from one and six months ago, if there are any.
+func GetMemoriesToday(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	today := user.Today()
+
+	// Leap days only come round every four years, so they are remembered on 28 February in between.
+	days := []int{today.Day()}
+	if today.Month() == time.February && today.Day() == 28 && !isLeapYear(today.Year()) {
+		days = append(days, 29)
+	}
+
+	var entries []models.JournalEntry
+	if err := db.Preload("Tags").
+		Where("user_id = ? AND entry_date < ?", user.ID, today).
+		Where("EXTRACT(MONTH FROM entry_date) = ? AND EXTRACT(DAY FROM entry_date) IN ?", int(today.Month()), days).
+		Order("entry_date DESC").
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving entries",
+		})
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	onThisDay := make([]MemoryResponse, 0, len(entries))
+	for _, entry := range entries {
+		decryptedContent, err := models.Decrypt(entry.EncryptedContent)
+		if err != nil {
+			continue
+		}
+
+		onThisDay = append(onThisDay, MemoryResponse{
+			YearsAgo: today.Year() - entry.EntryDate.Year(),
+			Entry:    newEntryResponse(entry, decryptedContent, wordGoals.On(entry.EntryDate)),
+		})
+	}
+
+	response := fiber.Map{
+		"date":        today.Format("2006-01-02"),
+		"on_this_day": onThisDay,
+	}
+
+	include := map[string]int{"month": 1, "six_months": 6}
+	for _, name := range strings.Split(c.Query("include"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		months, ok := include[name]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "include can only contain month and six_months",
+			})
+		}
+
+		var entry models.JournalEntry
+		if err := db.Preload("Tags").
+			Where("user_id = ? AND entry_date = ?", user.ID, monthsBefore(today, months)).
+			Where("notebook_id IN (?)", db.Model(&models.Notebook{}).Select("id").Where("user_id = ? AND is_default", user.ID)).
+			Find(&entry).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error retrieving entries",
+			})
+		}
+
+		response[name+"_ago"] = nil
+		if entry.ID == 0 {
+			continue
+		}
+
+		decryptedContent, err := models.Decrypt(entry.EncryptedContent)
+		if err != nil {
+			continue
+		}
+		response[name+"_ago"] = newEntryResponse(entry, decryptedContent, wordGoals.On(entry.EntryDate))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
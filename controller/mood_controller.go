@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultMoodTrendDays = 30
+
+type MoodWeek struct {
+	WeekStart     string   `json:"week_start"`
+	AverageMood   *float64 `json:"average_mood"`
+	AverageEnergy *float64 `json:"average_energy"`
+	Days          int      `json:"days"`
+}
+
+// Running totals for one set of ratings; days without a rating are skipped.
+type moodAverage struct {
+	moodSum, energySum     float64
+	moodCount, energyCount int
+}
+
+func (a *moodAverage) add(point models.MoodPoint) {
+	if point.Mood != nil {
+		a.moodSum += *point.Mood
+		a.moodCount++
+	}
+	if point.Energy != nil {
+		a.energySum += *point.Energy
+		a.energyCount++
+	}
+}
+
+func (a moodAverage) averages() (*float64, *float64) {
+	return averageOf(a.moodSum, a.moodCount), averageOf(a.energySum, a.energyCount)
+}
+
+func averageOf(sum float64, count int) *float64 {
+	if count == 0 {
+		return nil
+	}
+	average := sum / float64(count)
+	return &average
+}
+
+// GetMoodTrend returns the mood and energy ratings between from and to
+// (inclusive, the last 30 days by default) along with overall and weekly averages.
+func GetMoodTrend(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	to, ok, err := helper.ParseDateQuery(c, "to")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid to date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("to"),
+		})
+	}
+	if !ok {
+		to = user.Today()
+	}
+
+	from, ok, err := helper.ParseDateQuery(c, "from")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid from date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("from"),
+		})
+	}
+	if !ok {
+		from = to.AddDate(0, 0, -(defaultMoodTrendDays - 1))
+	}
+
+	if to.Before(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from must not be after to",
+		})
+	}
+
+	var entries []models.JournalEntry
+	if err := db.Select("id", "entry_date", "mood", "energy").
+		Where("user_id = ? AND entry_date BETWEEN ? AND ?", user.ID, from, to).
+		Where("mood IS NOT NULL OR energy IS NOT NULL").
+		Order("entry_date ASC").
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving entries",
+		})
+	}
+
+	points := models.MoodPoints(entries)
+
+	var overall moodAverage
+	weeks := []MoodWeek{}
+	weekTotals := []moodAverage{}
+	for _, point := range points {
+		overall.add(point)
+
+		date, _ := time.Parse("2006-01-02", point.Date)
+		weekStart := models.WeekStart(date).Format("2006-01-02")
+		if len(weeks) == 0 || weeks[len(weeks)-1].WeekStart != weekStart {
+			weeks = append(weeks, MoodWeek{WeekStart: weekStart})
+			weekTotals = append(weekTotals, moodAverage{})
+		}
+		weekTotals[len(weekTotals)-1].add(point)
+		weeks[len(weeks)-1].Days++
+	}
+
+	for i := range weeks {
+		weeks[i].AverageMood, weeks[i].AverageEnergy = weekTotals[i].averages()
+	}
+
+	averageMood, averageEnergy := overall.averages()
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"from":           from.Format("2006-01-02"),
+		"to":             to.Format("2006-01-02"),
+		"points":         points,
+		"average_mood":   averageMood,
+		"average_energy": averageEnergy,
+		"weeks":          weeks,
+	})
+}
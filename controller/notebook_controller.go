@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxNotebookNameLength = 50
+
+type NotebookResponse struct {
+	ID               uint   `json:"ID"`
+	Name             string `json:"name"`
+	IsDefault        bool   `json:"is_default"`
+	CountsTowardGoal bool   `json:"counts_toward_goal"`
+	IncludeInSummary bool   `json:"include_in_summary"`
+	CreatedAt        string `json:"created_at"`
+}
+
+func newNotebookResponse(notebook models.Notebook, name string) NotebookResponse {
+	return NotebookResponse{
+		ID:               notebook.ID,
+		Name:             name,
+		IsDefault:        notebook.IsDefault,
+		CountsTowardGoal: notebook.CountsTowardGoal,
+		IncludeInSummary: notebook.IncludeInSummary,
+		CreatedAt:        notebook.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// findUserNotebook returns the notebook an entry should go to: the given one if
+// it belongs to the user, or the user's default notebook when id is nil.
+func findUserNotebook(userID uint, id *uint) (models.Notebook, error) {
+	db := initialisers.DB
+	if id == nil {
+		return models.DefaultNotebook(db, userID)
+	}
+
+	var notebook models.Notebook
+	err := db.Where("id = ? AND user_id = ?", *id, userID).First(&notebook).Error
+	return notebook, err
+}
+
+// goalNotebookIDs returns the set of the user's notebooks that count toward the daily goal.
+func goalNotebookIDs(userID uint) (map[uint]bool, error) {
+	var ids []uint
+	if err := models.GoalNotebooks(initialisers.DB, userID).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	goalNotebooks := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		goalNotebooks[id] = true
+	}
+	return goalNotebooks, nil
+}
+
+// validateNotebookName trims the name and checks it against the user's other
+// notebooks, decrypting them the same way validateTagName does for tags.
+func validateNotebookName(userID uint, name string, exceptID uint) (string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", "Notebook name is required"
+	}
+	if utf8.RuneCountInString(name) > maxNotebookNameLength {
+		return "", "Notebook name must be at most 50 characters long"
+	}
+
+	var notebooks []models.Notebook
+	if err := initialisers.DB.Where("user_id = ? AND id <> ?", userID, exceptID).Find(&notebooks).Error; err != nil {
+		return "", "Error checking existing notebooks"
+	}
+
+	for _, notebook := range notebooks {
+		existing, err := models.Decrypt(notebook.EncryptedName)
+		if err == nil && strings.EqualFold(existing, name) {
+			return "", "A notebook with this name already exists"
+		}
+	}
+
+	return name, ""
+}
+
+func GetNotebooks(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if _, err := models.DefaultNotebook(db, user.ID); err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var notebooks []models.Notebook
+	if err := db.Where("user_id = ?", user.ID).Order("is_default DESC").Order("id ASC").Find(&notebooks).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving notebooks",
+		})
+	}
+
+	// Notebooks whose names cannot be decrypted are left out rather than failing the whole response.
+	response := make([]NotebookResponse, 0, len(notebooks))
+	for _, notebook := range notebooks {
+		name, err := models.Decrypt(notebook.EncryptedName)
+		if err != nil {
+			continue
+		}
+		response = append(response, newNotebookResponse(notebook, name))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"notebooks": response,
+	})
+}
+
+func CreateNotebook(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	// Both flags are on unless the request turns them off.
+	var body struct {
+		Name             string `json:"name"`
+		CountsTowardGoal *bool  `json:"counts_toward_goal"`
+		IncludeInSummary *bool  `json:"include_in_summary"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	name, message := validateNotebookName(user.ID, body.Name, 0)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	encryptedName, err := models.Encrypt(name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process notebook",
+		})
+	}
+
+	notebook := models.Notebook{
+		UserID:           user.ID,
+		EncryptedName:    encryptedName,
+		CountsTowardGoal: body.CountsTowardGoal == nil || *body.CountsTowardGoal,
+		IncludeInSummary: body.IncludeInSummary == nil || *body.IncludeInSummary,
+	}
+
+	if err := db.Create(&notebook).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create notebook",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Notebook created successfully",
+		"notebook": newNotebookResponse(notebook, name),
+	})
+}
+
+func UpdateNotebook(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	// Fields left out of the request are not changed.
+	var body struct {
+		Name             *string `json:"name"`
+		CountsTowardGoal *bool   `json:"counts_toward_goal"`
+		IncludeInSummary *bool   `json:"include_in_summary"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var notebook models.Notebook
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&notebook).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	name, err := models.Decrypt(notebook.EncryptedName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting notebook",
+		})
+	}
+
+	updates := map[string]interface{}{}
+
+	if body.Name != nil {
+		var message string
+		name, message = validateNotebookName(user.ID, *body.Name, notebook.ID)
+		if message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+
+		encryptedName, err := models.Encrypt(name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to process notebook",
+			})
+		}
+		updates["encrypted_name"] = encryptedName
+	}
+
+	if body.CountsTowardGoal != nil {
+		updates["counts_toward_goal"] = *body.CountsTowardGoal
+		notebook.CountsTowardGoal = *body.CountsTowardGoal
+	}
+
+	if body.IncludeInSummary != nil {
+		updates["include_in_summary"] = *body.IncludeInSummary
+		notebook.IncludeInSummary = *body.IncludeInSummary
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&notebook).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update notebook",
+			})
+		}
+	}
+
+	// Which notebooks count toward the goal decides whether days were journaled.
+	if body.CountsTowardGoal != nil {
+		if err := clearUserCaches(user); err != nil {
+			log.Println("Error clearing cache:", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Notebook updated successfully",
+		"notebook": newNotebookResponse(notebook, name),
+	})
+}
+
+// DeleteNotebook deletes an empty notebook for good. Entries have to be deleted
+// and purged from the trash first, and the default notebook cannot be deleted.
+func DeleteNotebook(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var notebook models.Notebook
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&notebook).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if notebook.IsDefault {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The default notebook cannot be deleted",
+		})
+	}
+
+	var entryCount int64
+	if err := db.Unscoped().Model(&models.JournalEntry{}).Where("notebook_id = ?", notebook.ID).Count(&entryCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete notebook",
+		})
+	}
+
+	if entryCount > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":       "Notebook still has entries",
+			"entry_count": entryCount,
+		})
+	}
+
+	if err := db.Unscoped().Delete(&notebook).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete notebook",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notebook deleted successfully",
+	})
+}
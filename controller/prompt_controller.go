@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PromptResponse struct {
+	ID    uint   `json:"ID"`
+	Text  string `json:"text"`
+	Date  string `json:"date"`
+	Skips int    `json:"skips"`
+}
+
+func newPromptResponse(dailyPrompt models.DailyPrompt) PromptResponse {
+	return PromptResponse{
+		ID:    dailyPrompt.Prompt.ID,
+		Text:  dailyPrompt.Prompt.Text,
+		Date:  dailyPrompt.PromptDate.Format("2006-01-02"),
+		Skips: dailyPrompt.Skips,
+	}
+}
+
+// todaysPrompt returns the prompt the user was given today, picking and
+// storing one the first time it is asked for.
+func todaysPrompt(user models.User) (models.DailyPrompt, error) {
+	db := initialisers.DB
+	today := user.Today()
+
+	var dailyPrompt models.DailyPrompt
+	err := db.Preload("Prompt").Where("user_id = ? AND prompt_date = ?", user.ID, today).First(&dailyPrompt).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return dailyPrompt, err
+	}
+
+	prompt, err := models.PickPrompt(db, user.ID, today, 0, 0)
+	if err != nil {
+		return models.DailyPrompt{}, err
+	}
+
+	// Another request may have picked the prompt in the meantime; its choice is kept.
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "prompt_date"}},
+		DoNothing: true,
+	}).Create(&models.DailyPrompt{
+		UserID:     user.ID,
+		PromptDate: today,
+		PromptID:   prompt.ID,
+	}).Error; err != nil {
+		return models.DailyPrompt{}, err
+	}
+
+	err = db.Preload("Prompt").Where("user_id = ? AND prompt_date = ?", user.ID, today).First(&dailyPrompt).Error
+	return dailyPrompt, err
+}
+
+func GetTodaysPrompt(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	dailyPrompt, err := todaysPrompt(user)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"prompt": newPromptResponse(dailyPrompt),
+	})
+}
+
+// SkipTodaysPrompt swaps today's prompt for a different one.
+func SkipTodaysPrompt(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	dailyPrompt, err := todaysPrompt(user)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	prompt, err := models.PickPrompt(db, user.ID, dailyPrompt.PromptDate, dailyPrompt.Skips+1, dailyPrompt.PromptID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	// Matching on skips makes two quick skips count as one instead of racing.
+	result := db.Model(&models.DailyPrompt{}).
+		Where("id = ? AND skips = ?", dailyPrompt.ID, dailyPrompt.Skips).
+		Updates(map[string]interface{}{
+			"prompt_id": prompt.ID,
+			"skips":     dailyPrompt.Skips + 1,
+		})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error skipping prompt",
+		})
+	}
+
+	if result.RowsAffected > 0 {
+		dailyPrompt.PromptID = prompt.ID
+		dailyPrompt.Prompt = prompt
+		dailyPrompt.Skips++
+	} else if dailyPrompt, err = todaysPrompt(user); err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"prompt": newPromptResponse(dailyPrompt),
+	})
+}
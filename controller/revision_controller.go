@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Used in place of a revision number to refer to the entry as it is now.
+const currentRevision = "current"
+
+type RevisionResponse struct {
+	Revision  uint   `json:"revision"`
+	EntryID   uint   `json:"entry_id"`
+	Content   string `json:"content,omitempty"`
+	WordCount int    `json:"word_count"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newRevisionResponse(revision models.EntryRevision, content string) RevisionResponse {
+	return RevisionResponse{
+		Revision:  revision.Revision,
+		EntryID:   revision.JournalEntryID,
+		Content:   content,
+		WordCount: revision.WordCount,
+		CreatedAt: revision.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// saveEntryRevision stores the entry's content, as it was before an update, as
+// its next revision. It has to run in the transaction that made the update, after
+// the version check, so concurrent writers never race for a revision number.
+func saveEntryRevision(tx *gorm.DB, entry models.JournalEntry) error {
+	var latest uint
+	if err := tx.Unscoped().Model(&models.EntryRevision{}).
+		Where("journal_entry_id = ?", entry.ID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&latest).Error; err != nil {
+		return err
+	}
+
+	revision := models.EntryRevision{
+		JournalEntryID:   entry.ID,
+		UserID:           entry.UserID,
+		Revision:         latest + 1,
+		EncryptedContent: entry.EncryptedContent,
+		WordCount:        entry.WordCount,
+	}
+
+	return tx.Create(&revision).Error
+}
+
+// findRevision looks up a numbered revision of the entry, or the entry itself for "current".
+func findRevision(entry models.JournalEntry, rev string) (models.EntryRevision, error) {
+	if rev == currentRevision {
+		return models.EntryRevision{
+			JournalEntryID:   entry.ID,
+			UserID:           entry.UserID,
+			EncryptedContent: entry.EncryptedContent,
+			WordCount:        entry.WordCount,
+		}, nil
+	}
+
+	number, err := strconv.ParseUint(rev, 10, 64)
+	if err != nil {
+		return models.EntryRevision{}, gorm.ErrRecordNotFound
+	}
+
+	var revision models.EntryRevision
+	err = initialisers.DB.Where("journal_entry_id = ? AND revision = ?", entry.ID, number).First(&revision).Error
+	return revision, err
+}
+
+func GetEntryRevisions(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to view this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var revisions []models.EntryRevision
+	if err := db.Where("journal_entry_id = ?", entry.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving revisions",
+		})
+	}
+
+	response := make([]RevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		response = append(response, newRevisionResponse(revision, ""))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"revisions": response,
+	})
+}
+
+func GetEntryRevision(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to view this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	revision, err := findRevision(entry, c.Params("rev"))
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	decryptedContent, err := models.Decrypt(revision.EncryptedContent)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting content",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"revision": newRevisionResponse(revision, decryptedContent),
+	})
+}
+
+// DiffEntryRevisions compares two versions of an entry word by word. Both from
+// and to take a revision number or "current"; by default the latest revision
+// is compared with the current content.
+func DiffEntryRevisions(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to view this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	fromRev := c.Query("from")
+	if fromRev == "" {
+		var latest models.EntryRevision
+		if err := db.Where("journal_entry_id = ?", entry.ID).Order("revision DESC").First(&latest).Error; err != nil {
+			return helper.HandleError(c, err)
+		}
+		fromRev = strconv.FormatUint(uint64(latest.Revision), 10)
+	}
+	toRev := c.Query("to", currentRevision)
+
+	contents := make([]string, 0, 2)
+	for _, rev := range []string{fromRev, toRev} {
+		revision, err := findRevision(entry, rev)
+		if err != nil {
+			return helper.HandleError(c, err)
+		}
+
+		decryptedContent, err := models.Decrypt(revision.EncryptedContent)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decrypting content",
+			})
+		}
+		contents = append(contents, decryptedContent)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"from": fromRev,
+		"to":   toRev,
+		"diff": helper.DiffWords(contents[0], contents[1]),
+	})
+}
+
+// RestoreEntryRevision puts an old revision back as the entry's content. The
+// content being replaced is kept as a new revision, so a restore can be undone.
+func RestoreEntryRevision(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to update this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Preload("Tags").Where("id = ? AND user_id = ?", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if c.Params("rev") == currentRevision {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Only a numbered revision can be restored",
+		})
+	}
+
+	revision, err := findRevision(entry, c.Params("rev"))
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	decryptedContent, err := models.Decrypt(revision.EncryptedContent)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting content",
+		})
+	}
+
+	if !ifMatchAllows(c, entry) {
+		return versionConflictResponse(c, entry.ID, user.ID)
+	}
+
+	if err := writeEntry(&entry, entryChanges{EncryptedContent: &revision.EncryptedContent, Content: decryptedContent}); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			return versionConflictResponse(c, entry.ID, user.ID)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error restoring revision",
+		})
+	}
+
+	if err := clearUserCaches(user); err != nil {
+		log.Println("Error clearing cache:", err)
+	}
+
+	wordGoal, err := models.WordGoalOn(db, user.ID, entry.EntryDate)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, entryETag(entry))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Revision restored successfully",
+		"entry":   newEntryResponse(entry, decryptedContent, wordGoal),
+	})
+}
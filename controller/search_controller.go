@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxSearchTerms = 20
+
+type SearchResult struct {
+	ID   uint   `json:"ID"`
+	Date string `json:"date"`
+}
+
+// indexEntry rebuilds the entry's blind index from its plain content. Without a
+// search key the entry is only dropped from the index, so writing never fails
+// because search is not set up.
+func indexEntry(tx *gorm.DB, entry models.JournalEntry, content string) error {
+	tokens, err := models.SearchTokensFor(entry.UserID, helper.SearchTerms(content))
+	if err != nil {
+		log.Printf("Error indexing entry %d for search: %v\n", entry.ID, err)
+		tokens = nil
+	}
+	return models.ReplaceSearchTokens(tx, entry, tokens)
+}
+
+// SearchEntries finds the user's entries that contain every word of q, newest
+// first. Only whole words match since the index holds hashes, not text.
+func SearchEntries(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	terms := helper.SearchTerms(c.Query("q"))
+	if len(terms) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is required",
+		})
+	}
+	if len(terms) > maxSearchTerms {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Search query can have at most %d words", maxSearchTerms),
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultEntriesPageSize)
+	if limit < 1 || limit > maxEntriesPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("limit must be between 1 and %d", maxEntriesPageSize),
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	tokens, err := models.SearchTokensFor(user.ID, terms)
+	if err != nil {
+		log.Println("Error building search tokens:", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Search is not available",
+		})
+	}
+
+	matching := db.Model(&models.SearchToken{}).
+		Select("journal_entry_id").
+		Where("user_id = ? AND token IN ?", user.ID, tokens).
+		Group("journal_entry_id").
+		Having("COUNT(DISTINCT token) = ?", len(tokens))
+
+	var entries []models.JournalEntry
+	if err := db.Select("id", "entry_date").
+		Where("user_id = ? AND id IN (?)", user.ID, matching).
+		Order("entry_date DESC").
+		Limit(limit).
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error searching entries",
+		})
+	}
+
+	results := make([]SearchResult, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, SearchResult{
+			ID:   entry.ID,
+			Date: entry.EntryDate.Format("2006-01-02"),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"results": results,
+	})
+}
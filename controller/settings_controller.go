@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	minDailyWordGoal = 1
+	maxDailyWordGoal = 10000
+)
+
+type WordGoalResponse struct {
+	Goal          int    `json:"goal"`
+	EffectiveFrom string `json:"effective_from"`
+}
+
+func newWordGoalResponses(goals models.WordGoals) []WordGoalResponse {
+	response := make([]WordGoalResponse, 0, len(goals))
+	for _, goal := range goals {
+		response = append(response, WordGoalResponse{
+			Goal:          goal.Goal,
+			EffectiveFrom: goal.EffectiveFrom.Format("2006-01-02"),
+		})
+	}
+	return response
+}
+
+func GetSettings(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"settings": fiber.Map{
+			"daily_word_goal": wordGoals.On(user.Today()),
+			"word_goals":      newWordGoalResponses(wordGoals),
+			"time_zone":       user.Location().String(),
+		},
+	})
+}
+
+func GetWordGoalHistory(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"default_word_goal": models.DailyWordGoal,
+		"word_goals":        newWordGoalResponses(wordGoals),
+	})
+}
+
+func UpdateSettings(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var body struct {
+		DailyWordGoal *int   `json:"daily_word_goal"`
+		EffectiveFrom string `json:"effective_from"`
+		TimeZone      string `json:"time_zone"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	// Everything is validated before anything is written, so a request is applied whole or not at all.
+	updatedUser := user
+	if body.TimeZone != "" {
+		if _, err := time.LoadLocation(body.TimeZone); err != nil || body.TimeZone == "Local" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":            "Invalid time_zone. Please use an IANA time zone such as Europe/London",
+				"receivedTimeZone": body.TimeZone,
+			})
+		}
+		updatedUser.TimeZone = body.TimeZone
+	}
+
+	var wordGoal *models.WordGoal
+	if body.DailyWordGoal != nil {
+		goal := *body.DailyWordGoal
+		if goal < minDailyWordGoal || goal > maxDailyWordGoal {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Daily word goal must be between 1 and 10000",
+			})
+		}
+
+		// Today is taken in the time zone the request switches to, if any.
+		today := updatedUser.Today()
+		effectiveFrom := today
+		if body.EffectiveFrom != "" {
+			parsedDate, err := time.Parse("2006-01-02", body.EffectiveFrom)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":        "Invalid effective_from. Please use YYYY-MM-DD format",
+					"receivedDate": body.EffectiveFrom,
+				})
+			}
+			effectiveFrom = parsedDate
+		}
+
+		// Past days keep the goal they were written against.
+		if effectiveFrom.Before(today) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "effective_from cannot be in the past",
+			})
+		}
+
+		wordGoal = &models.WordGoal{
+			UserID:        user.ID,
+			Goal:          goal,
+			EffectiveFrom: effectiveFrom,
+		}
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if body.TimeZone != "" {
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("time_zone", updatedUser.TimeZone).Error; err != nil {
+				return err
+			}
+		}
+
+		if wordGoal != nil {
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "effective_from"}},
+				DoUpdates: clause.AssignmentColumns([]string{"goal", "updated_at"}),
+			}).Create(wordGoal).Error
+		}
+		return nil
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update settings",
+		})
+	}
+
+	// Cached keys are per local day, so a new time zone means clearing them under the old one.
+	if body.TimeZone != "" {
+		if err := clearUserCaches(user); err != nil {
+			log.Println("Error clearing cache:", err)
+		}
+	}
+	user = updatedUser
+
+	if wordGoal != nil {
+		if err := clearUserCaches(user); err != nil {
+			log.Println("Error clearing cache:", err)
+		}
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Settings updated successfully",
+		"settings": fiber.Map{
+			"daily_word_goal": wordGoals.On(user.Today()),
+			"word_goals":      newWordGoalResponses(wordGoals),
+			"time_zone":       user.Location().String(),
+		},
+	})
+}
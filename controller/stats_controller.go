@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MonthStats struct {
+	Month   string `json:"month"`
+	Entries int    `json:"entries"`
+	Words   int    `json:"words"`
+}
+
+type JournalStats struct {
+	CurrentStreak        int          `json:"current_streak"`
+	LongestStreak        int          `json:"longest_streak"`
+	TotalEntries         int          `json:"total_entries"`
+	TotalWords           int          `json:"total_words"`
+	AverageWordsPerEntry float64      `json:"average_words_per_entry"`
+	Months               []MonthStats `json:"months"`
+}
+
+func statsCacheKey(user models.User) string {
+	currentDate := user.Today().Format("2006-01-02")
+	return fmt.Sprintf("daily-150:stats:%s:%d", currentDate, user.ID)
+}
+
+// A day counts towards a streak only when the words written that day in
+// notebooks that count toward the goal met the goal in effect on that day.
+// today is the user's local calendar day.
+func computeJournalStats(entries []models.JournalEntry, goalNotebooks map[uint]bool, wordGoals models.WordGoals, today time.Time) JournalStats {
+	stats := JournalStats{Months: []MonthStats{}}
+	goalWords := make(map[string]int)
+	months := make(map[string]*MonthStats)
+
+	for _, entry := range entries {
+		stats.TotalEntries++
+		stats.TotalWords += entry.WordCount
+
+		day := entry.EntryDate
+		month := day.Format("2006-01")
+		if months[month] == nil {
+			months[month] = &MonthStats{Month: month}
+		}
+		months[month].Entries++
+		months[month].Words += entry.WordCount
+
+		if goalNotebooks[entry.NotebookID] {
+			goalWords[day.Format("2006-01-02")] += entry.WordCount
+		}
+	}
+
+	goalDays := make(map[string]bool)
+	for key, words := range goalWords {
+		day, _ := time.Parse("2006-01-02", key)
+		if words >= wordGoals.On(day) {
+			goalDays[key] = true
+		}
+	}
+
+	if stats.TotalEntries > 0 {
+		stats.AverageWordsPerEntry = float64(stats.TotalWords) / float64(stats.TotalEntries)
+	}
+
+	for _, month := range months {
+		stats.Months = append(stats.Months, *month)
+	}
+	sort.Slice(stats.Months, func(i, j int) bool {
+		return stats.Months[i].Month < stats.Months[j].Month
+	})
+
+	days := make([]string, 0, len(goalDays))
+	for day := range goalDays {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	run := 0
+	var previous time.Time
+	for _, day := range days {
+		date, _ := time.Parse("2006-01-02", day)
+		if run > 0 && date.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		previous = date
+		stats.LongestStreak = max(stats.LongestStreak, run)
+	}
+
+	// Today's entry may not be written yet, so an unbroken run up to yesterday still counts.
+	day := today
+	if !goalDays[day.Format("2006-01-02")] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for goalDays[day.Format("2006-01-02")] {
+		stats.CurrentStreak++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return stats
+}
+
+func GetStats(c *fiber.Ctx) error {
+	db := initialisers.DB
+	redis := initialisers.RedisClient
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	ctx := context.Background()
+	redisKey := statsCacheKey(user)
+	if cached, err := redis.Get(ctx, redisKey).Result(); err == nil {
+		var stats JournalStats
+		if err := json.Unmarshal([]byte(cached), &stats); err == nil {
+			log.Println("Serving stats from cache")
+			return c.Status(fiber.StatusOK).JSON(fiber.Map{
+				"stats": stats,
+			})
+		}
+	}
+
+	var entries []models.JournalEntry
+	if err := db.Select("id", "notebook_id", "entry_date", "word_count").Where("user_id = ?", user.ID).Order("entry_date ASC").Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving entries",
+		})
+	}
+
+	wordGoals, err := models.LoadWordGoals(db, user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	goalNotebooks, err := goalNotebookIDs(user.ID)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	stats := computeJournalStats(entries, goalNotebooks, wordGoals, user.Today())
+
+	statsJSON, err := json.Marshal(stats)
+	if err == nil {
+		if err := redis.Set(ctx, redisKey, statsJSON, 24*time.Hour).Err(); err != nil {
+			log.Println("Error saving stats to cache:", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"stats": stats,
+	})
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"daily-150/routines"
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Dead tasks are listed without their entries, which are the user's decrypted writing.
+type DeadSummaryTaskResponse struct {
+	UserID     uint   `json:"user_id"`
+	WeekStart  string `json:"week_start,omitempty"`
+	EntryCount int    `json:"entry_count"`
+	Attempts   int    `json:"attempts"`
+	LastError  string `json:"last_error"`
+	FailedAt   string `json:"failed_at,omitempty"`
+}
+
+// GetDeadSummaryTasks lists the summary tasks that ran out of attempts, along
+// with how many tasks are queued and how many are waiting to be retried.
+func GetDeadSummaryTasks(c *fiber.Ctx) error {
+	redisClient := initialisers.RedisClient
+	if redisClient == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Redis client not initialised",
+		})
+	}
+
+	ctx := context.Background()
+	dead, err := redisClient.LRange(ctx, routines.SummaryDeadQueue, 0, -1).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving dead tasks",
+		})
+	}
+
+	tasks := make([]DeadSummaryTaskResponse, 0, len(dead))
+	for _, taskJSON := range dead {
+		var task models.SummaryTask
+		if err := json.Unmarshal([]byte(taskJSON), &task); err != nil {
+			log.Println("Error unmarshalling dead task: ", err)
+			continue
+		}
+
+		response := DeadSummaryTaskResponse{
+			UserID:     task.UserID,
+			WeekStart:  task.WeekStart,
+			EntryCount: len(task.Entries),
+			Attempts:   task.Attempts,
+			LastError:  task.LastError,
+		}
+		if task.FailedAt != nil {
+			response.FailedAt = task.FailedAt.Format("2006-01-02 15:04:05")
+		}
+		tasks = append(tasks, response)
+	}
+
+	// Handled tasks are deleted from the stream, so its length is what is still waiting or being worked on.
+	queued, err := redisClient.XLen(ctx, routines.SummaryStream).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving queue length",
+		})
+	}
+
+	retrying, err := redisClient.ZCard(ctx, routines.SummaryRetryQueue).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving retry queue length",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"queued":   queued,
+		"retrying": retrying,
+		"dead":     tasks,
+	})
+}
+
+// RequeueDeadSummaryTasks puts dead tasks back on the queue with a fresh set
+// of attempts. ?user_id= limits it to one user's tasks.
+func RequeueDeadSummaryTasks(c *fiber.Ctx) error {
+	if initialisers.RedisClient == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Redis client not initialised",
+		})
+	}
+
+	var userID *uint
+	if value := c.Query("user_id"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "user_id must be a number",
+			})
+		}
+		id := uint(parsed)
+		userID = &id
+	}
+
+	requeued, err := routines.RequeueDeadTasks(context.Background(), userID)
+	if err != nil {
+		log.Println("Error requeueing dead tasks: ", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":    "Error requeueing dead tasks",
+			"requeued": requeued,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Dead tasks requeued",
+		"requeued": requeued,
+	})
+}
@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxTagNameLength = 50
+
+var errUnknownTag = errors.New("tag does not exist")
+
+type TagResponse struct {
+	ID   uint   `json:"ID"`
+	Name string `json:"name"`
+}
+
+// Tags whose names cannot be decrypted are left out rather than failing the whole response.
+func newTagResponses(tags []models.Tag) []TagResponse {
+	response := make([]TagResponse, 0, len(tags))
+	for _, tag := range tags {
+		name, err := models.Decrypt(tag.EncryptedName)
+		if err != nil {
+			continue
+		}
+		response = append(response, TagResponse{ID: tag.ID, Name: name})
+	}
+	return response
+}
+
+// findUserTags loads the given tags, making sure every one of them belongs to the user.
+func findUserTags(userID uint, tagIDs []uint) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if len(tagIDs) == 0 {
+		return tags, nil
+	}
+
+	if err := initialisers.DB.Where("id IN ? AND user_id = ?", tagIDs, userID).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	unique := make(map[uint]bool, len(tagIDs))
+	for _, id := range tagIDs {
+		unique[id] = true
+	}
+	if len(tags) != len(unique) {
+		return nil, errUnknownTag
+	}
+
+	return tags, nil
+}
+
+func unknownTagResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errUnknownTag) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "One or more tags do not exist",
+		})
+	}
+	return helper.HandleError(c, err)
+}
+
+// validateTagName trims the name and checks it against the user's other tags.
+// Names are encrypted, so the comparison happens after decrypting them.
+func validateTagName(userID uint, name string, exceptID uint) (string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", "Tag name is required"
+	}
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", "Tag name must be at most 50 characters long"
+	}
+
+	var tags []models.Tag
+	if err := initialisers.DB.Where("user_id = ? AND id <> ?", userID, exceptID).Find(&tags).Error; err != nil {
+		return "", "Error checking existing tags"
+	}
+
+	for _, tag := range newTagResponses(tags) {
+		if strings.EqualFold(tag.Name, name) {
+			return "", "A tag with this name already exists"
+		}
+	}
+
+	return name, ""
+}
+
+func GetTags(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var tags []models.Tag
+	if err := db.Where("user_id = ?", user.ID).Order("id ASC").Find(&tags).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving tags",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"tags": newTagResponses(tags),
+	})
+}
+
+func CreateTag(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	name, message := validateTagName(user.ID, body.Name, 0)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	encryptedName, err := models.Encrypt(name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process tag",
+		})
+	}
+
+	tag := models.Tag{
+		UserID:        user.ID,
+		EncryptedName: encryptedName,
+	}
+
+	if err := db.Create(&tag).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create tag",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Tag created successfully",
+		"tag":     TagResponse{ID: tag.ID, Name: name},
+	})
+}
+
+func UpdateTag(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var tag models.Tag
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&tag).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	name, message := validateTagName(user.ID, body.Name, tag.ID)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	encryptedName, err := models.Encrypt(name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process tag",
+		})
+	}
+
+	if err := db.Model(&tag).Update("encrypted_name", encryptedName).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update tag",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Tag updated successfully",
+		"tag":     TagResponse{ID: tag.ID, Name: name},
+	})
+}
+
+// DeleteTag removes the tag from every entry it was on and then deletes it for good.
+func DeleteTag(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var tag models.Tag
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&tag).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM entry_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&tag).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete tag",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Tag deleted successfully",
+	})
+}
@@ -0,0 +1,421 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTemplateNameLength    = 50
+	maxTemplateContentLength = 20000
+)
+
+type TemplateResponse struct {
+	ID        uint   `json:"ID"`
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func newTemplateResponse(template models.Template) (TemplateResponse, error) {
+	name, err := models.Decrypt(template.EncryptedName)
+	if err != nil {
+		return TemplateResponse{}, err
+	}
+
+	content, err := models.Decrypt(template.EncryptedContent)
+	if err != nil {
+		return TemplateResponse{}, err
+	}
+
+	return TemplateResponse{
+		ID:        template.ID,
+		Name:      name,
+		Content:   content,
+		CreatedAt: template.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt: template.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+// validateTemplateName trims the name and checks it against the user's other
+// templates, decrypting them the same way validateTagName does for tags.
+func validateTemplateName(userID uint, name string, exceptID uint) (string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", "Template name is required"
+	}
+	if utf8.RuneCountInString(name) > maxTemplateNameLength {
+		return "", "Template name must be at most 50 characters long"
+	}
+
+	var templates []models.Template
+	if err := initialisers.DB.Where("user_id = ? AND id <> ?", userID, exceptID).Find(&templates).Error; err != nil {
+		return "", "Error checking existing templates"
+	}
+
+	for _, template := range templates {
+		existing, err := models.Decrypt(template.EncryptedName)
+		if err == nil && strings.EqualFold(existing, name) {
+			return "", "A template with this name already exists"
+		}
+	}
+
+	return name, ""
+}
+
+func validateTemplateContent(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return "Template content is required"
+	}
+	if utf8.RuneCountInString(content) > maxTemplateContentLength {
+		return "Template content must be at most 20000 characters long"
+	}
+	return ""
+}
+
+// renderTemplate fills in the template's placeholders for the given day:
+// {{date}}, {{weekday}} and {{prompt}}. When the prompt is used its ID is
+// returned so the entry can record it. With pickPrompt, today's prompt is
+// picked and stored if the user has not been given one yet; otherwise only a
+// stored prompt is used and {{prompt}} is left empty without one.
+func renderTemplate(user models.User, template models.Template, date time.Time, pickPrompt bool) (string, *uint, error) {
+	content, err := models.Decrypt(template.EncryptedContent)
+	if err != nil {
+		return "", nil, err
+	}
+
+	values := map[string]string{
+		"date":    date.Format("2006-01-02"),
+		"weekday": date.Weekday().String(),
+		"prompt":  "",
+	}
+
+	var promptID *uint
+	if helper.HasPlaceholder(content, "prompt") {
+		var dailyPrompt models.DailyPrompt
+		if pickPrompt && date.Equal(user.Today()) {
+			dailyPrompt, err = todaysPrompt(user)
+		} else {
+			err = initialisers.DB.Preload("Prompt").Where("user_id = ? AND prompt_date = ?", user.ID, date).First(&dailyPrompt).Error
+		}
+
+		switch {
+		case err == nil:
+			values["prompt"] = dailyPrompt.Prompt.Text
+			promptID = &dailyPrompt.PromptID
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return "", nil, err
+		}
+	}
+
+	return helper.ExpandPlaceholders(content, values), promptID, nil
+}
+
+func GetTemplates(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var templates []models.Template
+	if err := db.Where("user_id = ?", user.ID).Order("id ASC").Find(&templates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving templates",
+		})
+	}
+
+	// Templates that cannot be decrypted are left out rather than failing the whole response.
+	response := make([]TemplateResponse, 0, len(templates))
+	for _, template := range templates {
+		templateResponse, err := newTemplateResponse(template)
+		if err != nil {
+			continue
+		}
+		response = append(response, templateResponse)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"templates": response,
+	})
+}
+
+func GetTemplate(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var template models.Template
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&template).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	response, err := newTemplateResponse(template)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"template": response,
+	})
+}
+
+// RenderTemplate shows what an entry created from the template would contain
+// on the given date (today by default), so the editor can be pre-filled. It only
+// reads: today's prompt shows up once it has been picked.
+func RenderTemplate(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	date, ok, err := helper.ParseDateQuery(c, "date")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":        "Invalid date. Please use YYYY-MM-DD format",
+			"receivedDate": c.Query("date"),
+		})
+	}
+	if !ok {
+		date = user.Today()
+	}
+
+	var template models.Template
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&template).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	content, promptID, err := renderTemplate(user, template, date, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error rendering template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"date":      date.Format("2006-01-02"),
+		"content":   content,
+		"prompt_id": promptID,
+	})
+}
+
+func CreateTemplate(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var body struct {
+		Name    string `json:"name"`
+		Content string `json:"content"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	name, message := validateTemplateName(user.ID, body.Name, 0)
+	if message == "" {
+		message = validateTemplateContent(body.Content)
+	}
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	encryptedName, err := models.Encrypt(name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process template",
+		})
+	}
+
+	encryptedContent, err := models.Encrypt(body.Content)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process template",
+		})
+	}
+
+	template := models.Template{
+		UserID:           user.ID,
+		EncryptedName:    encryptedName,
+		EncryptedContent: encryptedContent,
+	}
+
+	if err := db.Create(&template).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create template",
+		})
+	}
+
+	response, err := newTemplateResponse(template)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting template",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Template created successfully",
+		"template": response,
+	})
+}
+
+func UpdateTemplate(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	// Fields left out of the request are not changed.
+	var body struct {
+		Name    *string `json:"name"`
+		Content *string `json:"content"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var template models.Template
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&template).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	updates := map[string]interface{}{}
+
+	if body.Name != nil {
+		name, message := validateTemplateName(user.ID, *body.Name, template.ID)
+		if message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+
+		encryptedName, err := models.Encrypt(name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to process template",
+			})
+		}
+		updates["encrypted_name"] = encryptedName
+		template.EncryptedName = encryptedName
+	}
+
+	if body.Content != nil {
+		if message := validateTemplateContent(*body.Content); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+
+		encryptedContent, err := models.Encrypt(*body.Content)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to process template",
+			})
+		}
+		updates["encrypted_content"] = encryptedContent
+		template.EncryptedContent = encryptedContent
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&template).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update template",
+			})
+		}
+	}
+
+	response, err := newTemplateResponse(template)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Template updated successfully",
+		"template": response,
+	})
+}
+
+// DeleteTemplate deletes the template for good. Entries created from it keep their content.
+func DeleteTemplate(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var template models.Template
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&template).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if err := db.Unscoped().Delete(&template).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Template deleted successfully",
+	})
+}
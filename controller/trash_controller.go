@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type TrashedEntryResponse struct {
+	ID         uint   `json:"ID"`
+	Date       string `json:"date"`
+	WordCount  int    `json:"word_count"`
+	DeletedAt  string `json:"deleted_at"`
+	PurgeAfter string `json:"purge_after"`
+}
+
+// GetTrash lists the user's deleted entries, most recently deleted first.
+// Content stays encrypted; an entry has to be restored to be read again.
+func GetTrash(c *fiber.Ctx) error {
+	db := initialisers.DB
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return helper.HandleError(c, fiber.ErrUnauthorized)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entries []models.JournalEntry
+	if err := db.Unscoped().
+		Select("id", "entry_date", "word_count", "deleted_at").
+		Where("user_id = ? AND deleted_at IS NOT NULL", user.ID).
+		Order("deleted_at DESC").
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving trash",
+		})
+	}
+
+	retention := helper.TrashRetention()
+	response := make([]TrashedEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, TrashedEntryResponse{
+			ID:         entry.ID,
+			Date:       entry.EntryDate.Format("2006-01-02"),
+			WordCount:  entry.WordCount,
+			DeletedAt:  entry.DeletedAt.Time.Format("2006-01-02 15:04:05"),
+			PurgeAfter: entry.DeletedAt.Time.Add(retention).Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"entries": response,
+	})
+}
+
+func RestoreEntry(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to restore this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Unscoped().Preload("Tags").Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	// The day may have been written again in the same notebook since this entry was deleted.
+	var existingEntry models.JournalEntry
+	if err := db.Where("user_id = ? AND notebook_id = ? AND entry_date = ?", user.ID, entry.NotebookID, entry.EntryDate).First(&existingEntry).Error; err == nil {
+		return entryExistsResponse(c, existingEntry)
+	}
+
+	decryptedContent, err := models.Decrypt(entry.EncryptedContent)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error decrypting content",
+		})
+	}
+
+	// Entries trashed before search existed were never indexed, so index them on the way back.
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&entry).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return indexEntry(tx, entry, decryptedContent)
+	}); err != nil {
+		// The day may also have been written after the check above.
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			if err := db.Where("user_id = ? AND notebook_id = ? AND entry_date = ?", user.ID, entry.NotebookID, entry.EntryDate).First(&existingEntry).Error; err == nil {
+				return entryExistsResponse(c, existingEntry)
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error restoring entry",
+		})
+	}
+
+	if err := clearUserCaches(user); err != nil {
+		log.Println("Error clearing cache:", err)
+	}
+
+	wordGoal, err := models.WordGoalOn(db, user.ID, entry.EntryDate)
+	if err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Entry restored successfully",
+		"entry":   newEntryResponse(entry, decryptedContent, wordGoal),
+	})
+}
+
+// PurgeEntry permanently deletes an entry that is already in the trash.
+func PurgeEntry(c *fiber.Ctx) error {
+	db := initialisers.DB
+	id := c.Params("id")
+	username, ok := helper.GetUsername(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "You are not authorized to delete this entry",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	var entry models.JournalEntry
+	if err := db.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, user.ID).First(&entry).Error; err != nil {
+		return helper.HandleError(c, err)
+	}
+
+	if err := models.DeleteEntryAttachments(db, initialisers.BlobStore, []uint{entry.ID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting attachments",
+		})
+	}
+
+	if err := db.Unscoped().Delete(&entry).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting entry",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Entry permanently deleted",
+	})
+}
@@ -0,0 +1,26 @@
+package helper
+
+const (
+	defaultMaxAttachmentMB   = 10
+	defaultAttachmentQuotaMB = 200
+)
+
+// MaxAttachmentSize is the largest single file, in bytes, that can be attached to an entry.
+func MaxAttachmentSize() int64 {
+	return megabytesFromEnv("MAX_ATTACHMENT_MB", defaultMaxAttachmentMB)
+}
+
+// AttachmentQuota is how many bytes of attachments each user can store in total.
+func AttachmentQuota() int64 {
+	return megabytesFromEnv("ATTACHMENT_QUOTA_MB", defaultAttachmentQuotaMB)
+}
+
+func megabytesFromEnv(name string, fallback int) int64 {
+	return int64(intFromEnv(name, fallback, 1)) << 20
+}
+
+// MaxAttachmentRequestSize is the largest request body the upload route accepts:
+// the largest file plus room for the multipart framing around it.
+func MaxAttachmentRequestSize() int64 {
+	return MaxAttachmentSize() + 1<<20
+}
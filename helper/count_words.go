@@ -0,0 +1,64 @@
+package helper
+
+import (
+	"regexp"
+	"unicode"
+)
+
+var bareURL = regexp.MustCompile(`https?://\S+`)
+
+// CountWords returns the number of words in a journal entry. Words are counted
+// in the plain text MarkdownToText leaves, so markup and link targets never
+// count, a URL counts as one word, and every CJK ideograph or kana counts as a
+// word on its own since those scripts are not separated by spaces.
+func CountWords(content string) int {
+	return len(splitWords(content))
+}
+
+// splitWords breaks content into the words CountWords counts.
+func splitWords(content string) []string {
+	content = MarkdownToText(content)
+	content = bareURL.ReplaceAllString(content, "url")
+
+	words := []string{}
+	start := -1
+	runes := []rune(content)
+
+	endWord := func(end int) {
+		if start >= 0 {
+			words = append(words, string(runes[start:end]))
+			start = -1
+		}
+	}
+
+	for i, r := range runes {
+		switch {
+		case isCJK(r):
+			endWord(i)
+			words = append(words, string(r))
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r):
+			if start < 0 {
+				start = i
+			}
+		case start >= 0 && isWordJoiner(r) && i+1 < len(runes) && isWordRune(runes[i+1]):
+			// Keep contractions and hyphenated words such as "don't" or "well-known" together
+		default:
+			endWord(i)
+		}
+	}
+	endWord(len(runes))
+
+	return words
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+func isWordRune(r rune) bool {
+	return !isCJK(r) && (unicode.IsLetter(r) || unicode.IsNumber(r))
+}
+
+func isWordJoiner(r rune) bool {
+	return r == '\'' || r == '’' || r == '-'
+}
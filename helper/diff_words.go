@@ -0,0 +1,186 @@
+package helper
+
+import "strings"
+
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// Beyond this many word edits the texts are treated as completely rewritten,
+// which keeps the time a diff takes bounded.
+const maxDiffEdits = 1000
+
+// DiffWords returns a word-level diff that turns before into after.
+// Consecutive words with the same operation are joined into one item.
+func DiffWords(before, after string) []DiffOp {
+	a := strings.Fields(before)
+	b := strings.Fields(after)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := []DiffOp{}
+	ops = appendWords(ops, DiffEqual, a[:prefix])
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	ops = appendWords(ops, DiffEqual, a[len(a)-suffix:])
+
+	return mergeDiffOps(ops)
+}
+
+// diffMiddle runs Myers' algorithm over the part of the texts that differs.
+// It uses the linear space variant, which splits the texts around the middle
+// of a shortest edit script and diffs each half, so memory stays proportional
+// to the length of the texts.
+func diffMiddle(a, b []string) []DiffOp {
+	if len(a) == 0 || len(b) == 0 {
+		return rewrite(a, b)
+	}
+
+	d, x, y, u, v, ok := middleSnake(a, b, maxDiffEdits)
+	if !ok {
+		return rewrite(a, b)
+	}
+	return diffAround(nil, a, b, d, x, y, u, v)
+}
+
+func diffLinear(ops []DiffOp, a, b []string) []DiffOp {
+	if len(a) == 0 || len(b) == 0 {
+		return append(ops, rewrite(a, b)...)
+	}
+
+	d, x, y, u, v, _ := middleSnake(a, b, len(a)+len(b))
+	return diffAround(ops, a, b, d, x, y, u, v)
+}
+
+// diffAround appends the diff of a and b given the edit distance d and a
+// middle snake a[x:u] == b[y:v] from middleSnake.
+func diffAround(ops []DiffOp, a, b []string, d, x, y, u, v int) []DiffOp {
+	if d > 1 {
+		ops = diffLinear(ops, a[:x], b[:y])
+		ops = appendWords(ops, DiffEqual, a[x:u])
+		return diffLinear(ops, a[u:], b[v:])
+	}
+
+	// At most one word was inserted or deleted, after some shared words.
+	shared := 0
+	for shared < len(a) && shared < len(b) && a[shared] == b[shared] {
+		shared++
+	}
+	ops = appendWords(ops, DiffEqual, a[:shared])
+	if len(a) > len(b) {
+		ops = append(ops, DiffOp{Op: DiffDelete, Text: a[shared]})
+		return appendWords(ops, DiffEqual, a[shared+1:])
+	}
+	if len(b) > len(a) {
+		ops = append(ops, DiffOp{Op: DiffInsert, Text: b[shared]})
+		return appendWords(ops, DiffEqual, b[shared+1:])
+	}
+	return ops
+}
+
+// middleSnake searches forwards from the start and backwards from the end of
+// both texts at once until the paths meet. It returns the edit distance d and
+// the run of shared words a[x:u] == b[y:v] where they met. ok is false if
+// the texts are more than maxEdits edits apart.
+func middleSnake(a, b []string, maxEdits int) (d, x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+
+	maxD := min((n+m+1)/2, (maxEdits+1)/2)
+	offset := maxD + 1
+	// forward[k] is the furthest x reached on diagonal k = x-y from the start,
+	// backward[c] the furthest distance reached on diagonal c from the end.
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+backward[offset+c] >= n {
+				return 2*d - 1, startX, startY, x, y, 2*d-1 <= maxEdits
+			}
+		}
+
+		for c := -d; c <= d; c += 2 {
+			var back int
+			if c == -d || (c != d && backward[offset+c-1] < backward[offset+c+1]) {
+				back = backward[offset+c+1]
+			} else {
+				back = backward[offset+c-1] + 1
+			}
+
+			backY := back - c
+			startBack, startBackY := back, backY
+			for back < n && backY < m && a[n-1-back] == b[m-1-backY] {
+				back++
+				backY++
+			}
+			backward[offset+c] = back
+
+			if k := delta - c; !odd && k >= -d && k <= d && forward[offset+k]+back >= n {
+				return 2 * d, n - back, m - backY, n - startBack, m - startBackY, 2*d <= maxEdits
+			}
+		}
+	}
+
+	return 0, 0, 0, 0, 0, false
+}
+
+func rewrite(a, b []string) []DiffOp {
+	ops := appendWords(nil, DiffDelete, a)
+	return appendWords(ops, DiffInsert, b)
+}
+
+func appendWords(ops []DiffOp, op string, words []string) []DiffOp {
+	for _, word := range words {
+		ops = append(ops, DiffOp{Op: op, Text: word})
+	}
+	return ops
+}
+
+func mergeDiffOps(ops []DiffOp) []DiffOp {
+	merged := []DiffOp{}
+	for start := 0; start < len(ops); {
+		end := start + 1
+		for end < len(ops) && ops[end].Op == ops[start].Op {
+			end++
+		}
+
+		words := make([]string, 0, end-start)
+		for _, op := range ops[start:end] {
+			words = append(words, op.Text)
+		}
+		merged = append(merged, DiffOp{Op: ops[start].Op, Text: strings.Join(words, " ")})
+		start = end
+	}
+	return merged
+}
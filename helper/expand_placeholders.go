@@ -0,0 +1,30 @@
+package helper
+
+import (
+	"regexp"
+	"strings"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([a-zA-Z_]+)\s*\}\}`)
+
+// ExpandPlaceholders replaces every {{name}} in text with values[name].
+// Names are matched case-insensitively and unknown placeholders are left as they are.
+func ExpandPlaceholders(text string, values map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.ToLower(placeholder.FindStringSubmatch(match)[1])
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// HasPlaceholder reports whether text uses {{name}}.
+func HasPlaceholder(text string, name string) bool {
+	for _, match := range placeholder.FindAllStringSubmatch(text, -1) {
+		if strings.EqualFold(match[1], name) {
+			return true
+		}
+	}
+	return false
+}
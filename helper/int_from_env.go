@@ -0,0 +1,24 @@
+package helper
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// intFromEnv reads a whole number setting from the environment, falling back
+// to fallback when it is unset, or logging and falling back when it is not a
+// number of at least minimum.
+func intFromEnv(name string, fallback, minimum int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < minimum {
+		log.Printf("Invalid %s %q, using %d\n", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,272 @@
+package helper
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Entries are CommonMark with strikethrough and bare URLs, parsed by goldmark.
+// Raw HTML in an entry is shown as text rather than passed through, links and
+// images with unsafe URLs are reduced to their text, and the rendered HTML goes
+// through a bluemonday allowlist before it is returned.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify),
+	goldmark.WithParserOptions(parser.WithASTTransformers(util.Prioritized(unsafeLinkFilter{}, 100))),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(rawHTMLRenderer{}, 100))),
+)
+
+var markdownPolicy = func() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements("p", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "code", "blockquote",
+		"ul", "ol", "li", "hr", "br", "strong", "em", "del")
+	policy.AllowAttrs("class").Matching(mdLanguageClass).OnElements("code")
+	policy.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	policy.AllowAttrs("href", "title").OnElements("a")
+	policy.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + linkRel + `$`)).OnElements("a")
+	policy.AllowAttrs("src", "alt", "title").OnElements("img")
+	policy.AllowURLSchemes("http", "https", "mailto")
+	policy.AllowRelativeURLs(true)
+	return policy
+}()
+
+const linkRel = "nofollow noopener noreferrer"
+
+var (
+	htmlTag         = regexp.MustCompile(`<[^>]+>`)
+	mdLanguageClass = regexp.MustCompile(`^language-[a-zA-Z0-9_+-]+$`)
+	mdSafeScheme    = regexp.MustCompile(`^(?i)(https?|mailto):`)
+	mdAnyScheme     = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	mdBlankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// goldmark takes quadratic time on blocks nested very deeply and on lines that
+// open very many link destinations, so entries with a line past these limits
+// are shown as plain text rather than parsed. Nesting shows up as a long run of
+// indentation, quote and list markers at the start of a line.
+const (
+	maxMarkdownLinePrefix = 256
+	maxMarkdownLineLinks  = 256
+)
+
+// Characters browsers strip from URLs before looking at the scheme.
+var mdIgnoredInURL = strings.NewReplacer("\t", "", "\n", "", "\r", "")
+
+// MarkdownToHTML renders markdown as sanitised HTML. Raw HTML is escaped and
+// the output only ever contains the allowlisted elements p, h1-h6, pre, code,
+// blockquote, ul, ol, li, hr, br, strong, em, del, a (href, title) and img
+// (src, alt, title). Link and image URLs must be relative or use http, https
+// or mailto.
+func MarkdownToHTML(content string) string {
+	if markdownTooComplex(content) {
+		return plainTextHTML(content)
+	}
+
+	var out bytes.Buffer
+	if err := markdown.Convert([]byte(content), &out); err != nil {
+		return plainTextHTML(content)
+	}
+	return strings.TrimSuffix(markdownPolicy.Sanitize(out.String()), "\n")
+}
+
+// MarkdownToText strips markdown and any raw HTML from content, leaving the
+// text a reader would see. Link targets are dropped and images are replaced by
+// their alt text.
+func MarkdownToText(content string) string {
+	if markdownTooComplex(content) {
+		return strings.TrimSpace(htmlTag.ReplaceAllString(content, " "))
+	}
+
+	source := []byte(content)
+	document := markdown.Parser().Parse(text.NewReader(source))
+
+	var out strings.Builder
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if node.Type() == ast.TypeBlock && node.Kind() != ast.KindDocument {
+				out.WriteString("\n\n")
+			}
+			return ast.WalkContinue, nil
+		}
+
+		switch node := node.(type) {
+		case *ast.Text:
+			out.Write(unescapeMarkdown(node.Segment.Value(source)))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				out.WriteString("\n")
+			}
+		case *ast.String:
+			out.Write(node.Value)
+		case *ast.AutoLink:
+			out.Write(node.Label(source))
+		case *ast.RawHTML:
+			out.WriteString(" ")
+		case *ast.HTMLBlock:
+			out.WriteString(htmlTag.ReplaceAllString(blockText(node, source), " "))
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			out.WriteString(blockText(node, source))
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(mdBlankLines.ReplaceAllString(out.String(), "\n\n"))
+}
+
+func markdownTooComplex(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		prefix := len(line) - len(strings.TrimLeft(line, " \t>-*+.)0123456789"))
+		if prefix > maxMarkdownLinePrefix || strings.Count(line, "](") > maxMarkdownLineLinks {
+			return true
+		}
+	}
+	return false
+}
+
+// plainTextHTML shows content as escaped paragraphs, for entries that are not
+// parsed as markdown.
+func plainTextHTML(content string) string {
+	var out strings.Builder
+	for _, paragraph := range strings.Split(strings.TrimSpace(content), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			out.WriteString("<p>" + html.EscapeString(paragraph) + "</p>\n")
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func unescapeMarkdown(value []byte) []byte {
+	return util.ResolveEntityNames(util.ResolveNumericReferences(util.UnescapePunctuations(value)))
+}
+
+// blockText returns the lines of a block, including the closing line of an
+// HTML block.
+func blockText(node ast.Node, source []byte) string {
+	var out strings.Builder
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		out.Write(line.Value(source))
+	}
+	if block, ok := node.(*ast.HTMLBlock); ok && block.HasClosure() {
+		out.Write(block.ClosureLine.Value(source))
+	}
+	return out.String()
+}
+
+// safeURL returns url if it is relative to this site or uses an allowed
+// scheme, and "" otherwise. Protocol-relative URLs such as //example.com are
+// refused, since browsers treat them, and /\example.com, as another host. The
+// scheme is also checked with character references decoded and the tabs and
+// newlines browsers ignore removed, so j&#97;vascript: cannot slip through.
+func safeURL(url string) string {
+	url = strings.TrimSpace(url)
+	for _, r := range url {
+		if r < ' ' || r == 0x7f {
+			return ""
+		}
+	}
+
+	for _, candidate := range []string{url, mdIgnoredInURL.Replace(html.UnescapeString(url))} {
+		candidate = strings.TrimSpace(candidate)
+		if mdAnyScheme.MatchString(candidate) && !mdSafeScheme.MatchString(candidate) {
+			return ""
+		}
+		if strings.HasPrefix(candidate, "//") || strings.HasPrefix(candidate, "\\") ||
+			strings.HasPrefix(candidate, "/\\") || strings.HasPrefix(candidate, "\\/") {
+			return ""
+		}
+	}
+	return url
+}
+
+// unsafeLinkFilter replaces links and images whose URL safeURL refuses with
+// their text, and marks the rest with linkRel. bluemonday would only drop the
+// attribute, leaving protocol-relative URLs and images without a source.
+type unsafeLinkFilter struct{}
+
+func (unsafeLinkFilter) Transform(document *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var unsafe []ast.Node
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := node.(type) {
+		case *ast.Link:
+			if safeURL(string(node.Destination)) == "" {
+				unsafe = append(unsafe, node)
+			} else {
+				node.SetAttributeString("rel", []byte(linkRel))
+			}
+		case *ast.Image:
+			if safeURL(string(node.Destination)) == "" {
+				unsafe = append(unsafe, node)
+			}
+		case *ast.AutoLink:
+			url := string(node.URL(source))
+			if node.AutoLinkType == ast.AutoLinkEmail {
+				url = "mailto:" + url
+			}
+			if safeURL(url) == "" {
+				unsafe = append(unsafe, node)
+			} else {
+				node.SetAttributeString("rel", []byte(linkRel))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, node := range unsafe {
+		parent := node.Parent()
+		if link, ok := node.(*ast.AutoLink); ok {
+			parent.ReplaceChild(parent, link, ast.NewString(link.Label(source)))
+			continue
+		}
+		for child := node.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, node, child)
+			child = next
+		}
+		parent.RemoveChild(parent, node)
+	}
+}
+
+// rawHTMLRenderer writes raw HTML out as escaped text, so an entry that
+// mentions a tag shows it instead of losing it.
+type rawHTMLRenderer struct{}
+
+func (rawHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindRawHTML, renderRawHTML)
+	reg.Register(ast.KindHTMLBlock, renderHTMLBlock)
+}
+
+func renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		segments := node.(*ast.RawHTML).Segments
+		for i := 0; i < segments.Len(); i++ {
+			segment := segments.At(i)
+			w.WriteString(html.EscapeString(string(segment.Value(source))))
+		}
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString("<p>")
+		w.WriteString(html.EscapeString(strings.TrimSuffix(blockText(node, source), "\n")))
+		w.WriteString("</p>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,118 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdownToHTMLDropsUnsafeURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		notWant []string
+	}{
+		{"javascript scheme", "[x](javascript:alert(1))", "<p>x</p>", []string{"href"}},
+		{"mixed case scheme", "[x](JaVaScRiPt:alert(1))", "<p>x</p>", []string{"href"}},
+		{"entity in scheme", "[x](j&#97;vascript:alert(1))", "<p>x</p>", []string{"href"}},
+		{"entity colon", "[x](&#106;avascript&#58;alert(1))", "<p>x</p>", []string{"href"}},
+		{"named entity colon", "[x](javascript&colon;alert(1))", "<p>x</p>", []string{"href"}},
+		{"hex entity", "[x](&#x6A;avascript:alert(1))", "<p>x</p>", []string{"href"}},
+		{"data scheme", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>", []string{"href"}},
+		{"vbscript scheme", "[x](VBScript:msgbox(1))", "<p>x</p>", []string{"href"}},
+		{"protocol relative", "[x](//evil.example)", "<p>x</p>", []string{"href"}},
+		{"backslash host", "[x](/\\evil.example)", "<p>x</p>", []string{"href"}},
+		{"double backslash host", "[x](\\\\evil.example)", "<p>x</p>", []string{"href"}},
+		{"image javascript", "![i](javascript:alert(1))", "<p>i</p>", []string{"src", "<img"}},
+		{"image protocol relative", "![i](//evil.example/a.png)", "<p>i</p>", []string{"src", "<img"}},
+		{"autolink javascript", "<javascript:alert(1)>", "", []string{"href"}},
+		{"raw script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>", []string{"<script"}},
+		{"raw img handler", `<img src=x onerror="alert(1)">`, "", []string{"<img", "onerror=\""}},
+		{"quote in title", `[x](https://ok.example "a" onmouseover="alert(1)")`, "", []string{` onmouseover="`}},
+		{"quote in fence language", "```a\"onclick=\"alert(1)\nhi\n```", "<pre><code>hi\n</code></pre>", []string{"onclick", "class="}},
+		{"angle in fence language", "```a><script>\nhi\n```", "<pre><code>hi\n</code></pre>", []string{"<script"}},
+		{"https link", "[x](https://ok.example)", `<p><a href="https://ok.example" rel="nofollow noopener noreferrer">x</a></p>`, nil},
+		{"relative link", "[x](/entry/1)", `<p><a href="/entry/1" rel="nofollow noopener noreferrer">x</a></p>`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MarkdownToHTML(tt.input)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("MarkdownToHTML(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			for _, bad := range tt.notWant {
+				if strings.Contains(got, bad) {
+					t.Errorf("MarkdownToHTML(%q) = %q, must not contain %q", tt.input, got, bad)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownToHTMLKeepsFenceLanguage(t *testing.T) {
+	got := MarkdownToHTML("```go\nfmt.Println(\"<hi>\")\n```")
+	want := `<pre><code class="language-go">fmt.Println(&#34;&lt;hi&gt;&#34;)` + "\n</code></pre>"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownPathologicalInputs(t *testing.T) {
+	const size = 100000
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unclosed emphasis", strings.Repeat("*a ", size/3)},
+		{"unclosed underscores", strings.Repeat("_a ", size/3)},
+		{"alternating emphasis", strings.Repeat("*_", size/2)},
+		{"closers only", strings.Repeat("a* ", size/3)},
+		{"open brackets", strings.Repeat("[", size)},
+		{"close brackets", strings.Repeat("]", size)},
+		{"unclosed links", strings.Repeat("[a](", size/4)},
+		{"nested links", strings.Repeat("[", size/2) + strings.Repeat("](x)", size/8)},
+		{"image openers", strings.Repeat("![", size/2)},
+		{"backticks", strings.Repeat("`", size)},
+		{"backtick runs", strings.Repeat("a``", size/3)},
+		{"growing backtick runs", growingRuns("`", 400)},
+		{"tildes", strings.Repeat("~~a ", size/4)},
+		{"angle brackets", strings.Repeat("<a", size/2)},
+		{"nested quotes", strings.Repeat(">", size)},
+		{"nested lists", nestedLists(2000)},
+		{"many lines", strings.Repeat("a *b\n", size/5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			MarkdownToHTML(tt.input)
+			MarkdownToText(tt.input)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("rendering %d bytes took %v", len(tt.input), elapsed)
+			}
+		})
+	}
+}
+
+// growingRuns returns runs of s of length 1, 2, ... n separated by spaces, so
+// that no run has a matching closer.
+func growingRuns(s string, n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		b.WriteString(strings.Repeat(s, i))
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func nestedLists(depth int) string {
+	var b strings.Builder
+	for i := 0; i < depth; i++ {
+		b.WriteString(strings.Repeat("  ", i))
+		b.WriteString("- a\n")
+	}
+	return b.String()
+}
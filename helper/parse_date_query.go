@@ -0,0 +1,22 @@
+package helper
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ParseDateQuery reads a YYYY-MM-DD query parameter. ok is false when the parameter was not sent.
+func ParseDateQuery(c *fiber.Ctx, key string) (date time.Time, ok bool, err error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	date, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return date, true, nil
+}
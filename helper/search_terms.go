@@ -0,0 +1,21 @@
+package helper
+
+import "strings"
+
+// SearchTerms returns the distinct words of content in the form they are
+// indexed and searched by: lower case, with typographic apostrophes made plain.
+func SearchTerms(content string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+
+	for _, word := range splitWords(content) {
+		term := strings.ToLower(strings.ReplaceAll(word, "’", "'"))
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		terms = append(terms, term)
+	}
+
+	return terms
+}
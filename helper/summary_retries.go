@@ -0,0 +1,25 @@
+package helper
+
+import "time"
+
+const (
+	defaultSummaryMaxAttempts = 5
+	summaryRetryBaseDelay     = 30 * time.Second
+	summaryRetryMaxDelay      = 1 * time.Hour
+)
+
+// SummaryMaxAttempts is how many times a summary task is tried before it is
+// moved to the dead-letter queue.
+func SummaryMaxAttempts() int {
+	return intFromEnv("SUMMARY_MAX_ATTEMPTS", defaultSummaryMaxAttempts, 1)
+}
+
+// SummaryRetryDelay is how long to wait before trying a task again after its
+// attempt'th failure. It doubles with every failure, up to an hour.
+func SummaryRetryDelay(attempt int) time.Duration {
+	delay := summaryRetryBaseDelay
+	for i := 1; i < attempt && delay < summaryRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, summaryRetryMaxDelay)
+}
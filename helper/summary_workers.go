@@ -0,0 +1,8 @@
+package helper
+
+const defaultSummaryWorkers = 5
+
+// SummaryWorkers is how many summary batches one server instance works on at once.
+func SummaryWorkers() int {
+	return intFromEnv("SUMMARY_WORKERS", defaultSummaryWorkers, 1)
+}
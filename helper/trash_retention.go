@@ -0,0 +1,10 @@
+package helper
+
+import "time"
+
+const defaultTrashRetentionDays = 30
+
+// TrashRetention is how long a deleted entry stays in the trash before it is purged for good.
+func TrashRetention() time.Duration {
+	return time.Duration(intFromEnv("TRASH_RETENTION_DAYS", defaultTrashRetentionDays, 1)) * 24 * time.Hour
+}
@@ -0,0 +1,36 @@
+package initialisers
+
+import (
+	"daily-150/storage"
+	"log"
+	"os"
+)
+
+var BlobStore storage.BlobStore
+
+// InitBlobStore sets up where attachments are kept. BLOB_STORE=s3 uses an
+// S3-compatible bucket; anything else keeps them on the local disk.
+func InitBlobStore() {
+	var err error
+
+	if os.Getenv("BLOB_STORE") == "s3" {
+		BlobStore, err = storage.NewS3BlobStore(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+	} else {
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "./data/attachments"
+		}
+		BlobStore, err = storage.NewLocalBlobStore(dir)
+	}
+
+	if err != nil {
+		log.Fatalln("Error setting up blob store:", err)
+	}
+	log.Println("Blob store ready")
+}
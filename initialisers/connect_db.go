@@ -13,7 +13,7 @@ var DB *gorm.DB
 func ConnectDB() {
 	var err error
 	dsn := os.Getenv("DATABASE_URL")
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatalln("Error connecting to the database")
 	} else {
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Routes under this prefix authenticate with ADMIN_API_KEY instead of a user's token.
+const adminPrefix = "/api/admin"
+
+func isAdminRoute(c *fiber.Ctx) bool {
+	path := c.Path()
+	return path == adminPrefix || strings.HasPrefix(path, adminPrefix+"/")
+}
+
+// CheckAdminKey checks the x-api-key header against ADMIN_API_KEY. The admin
+// routes stay closed while no key is configured.
+func CheckAdminKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		adminKey := os.Getenv("ADMIN_API_KEY")
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(c.Get("x-api-key")), []byte(adminKey)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -27,7 +27,7 @@ func CheckAuth() fiber.Handler {
 
 		log.Println("REQUEST RECEIVED")
 
-		if isIgnoredRoute(c) {
+		if isIgnoredRoute(c) || isAdminRoute(c) {
 			return c.Next()
 		}
 
@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"daily-150/helper"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// isAttachmentUpload reports whether the request is an upload to POST /api/entry/:id/attachments.
+func isAttachmentUpload(c *fiber.Ctx) bool {
+	if c.Method() != fiber.MethodPost {
+		return false
+	}
+	parts := strings.Split(strings.Trim(c.Path(), "/"), "/")
+	return len(parts) == 4 && parts[0] == "api" && parts[1] == "entry" && parts[3] == "attachments"
+}
+
+func bodyTooLargeResponse(c *fiber.Ctx) error {
+	// The rest of the body is never read, so the connection cannot be reused.
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"error": "Request body is too large",
+	})
+}
+
+// LimitBody rejects request bodies larger than limit. The server streams request
+// bodies so that attachments never have to be buffered whole, which means it no
+// longer enforces a body limit itself. Other bodies are read in full here, as
+// the server used to, while attachment uploads may be as large as
+// helper.MaxAttachmentRequestSize and are read by their handler as they arrive.
+func LimitBody(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		upload := isAttachmentUpload(c)
+
+		maxSize := int64(limit)
+		if upload {
+			maxSize = helper.MaxAttachmentRequestSize()
+		}
+
+		if int64(c.Request().Header.ContentLength()) > maxSize {
+			return bodyTooLargeResponse(c)
+		}
+
+		stream := c.Context().RequestBodyStream()
+		if stream == nil {
+			return c.Next()
+		}
+
+		if upload {
+			err := c.Next()
+
+			// Whatever the handler left unread has to come off the connection
+			// before it can serve another request.
+			if n, drainErr := io.Copy(io.Discard, io.LimitReader(stream, maxSize+1)); drainErr != nil || n > maxSize {
+				c.Context().SetConnectionClose()
+			}
+			return err
+		}
+
+		body, err := io.ReadAll(io.LimitReader(stream, maxSize+1))
+		if err != nil {
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to read request body",
+			})
+		}
+		if int64(len(body)) > maxSize {
+			return bodyTooLargeResponse(c)
+		}
+		c.Request().SetBody(body)
+
+		return c.Next()
+	}
+}
@@ -1,10 +1,355 @@
 package migrate
 
 import (
+	"daily-150/helper"
 	"daily-150/initialisers"
 	"daily-150/models"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 func RunMigrations() {
-	initialisers.DB.AutoMigrate(&models.User{}, &models.JournalEntry{}, &models.Summary{})
+	initialisers.DB.AutoMigrate(&models.User{})
+	prepareEntryDates()
+	if err := prepareNotebooks(); err != nil {
+		log.Fatalln("Error moving entries into notebooks:", err)
+	}
+	if err := prepareDrafts(); err != nil {
+		log.Fatalln("Error moving drafts into notebooks:", err)
+	}
+	initialisers.DB.AutoMigrate(&models.Notebook{}, &models.JournalEntry{}, &models.EntryRevision{}, &models.Summary{}, &models.WordGoal{}, &models.Draft{}, &models.Tag{}, &models.SearchToken{}, &models.Prompt{}, &models.DailyPrompt{}, &models.Template{}, &models.Attachment{}, &models.DataMigration{})
+	seedPrompts()
+	runOnce("recount_markdown_word_counts", recountWordCounts)
+	runOnce("backfill_search_tokens", backfillSearchTokens)
+}
+
+// runOnce runs a one-off data migration unless it has already finished, and
+// records it once it does. A migration that fails is tried again on the next start.
+func runOnce(name string, migration func() error) {
+	db := initialisers.DB
+
+	var count int64
+	if err := db.Model(&models.DataMigration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		log.Printf("Error checking data migration %s: %v\n", name, err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	if err := migration(); err != nil {
+		log.Printf("Data migration %s did not finish: %v\n", name, err)
+		return
+	}
+
+	if err := db.Create(&models.DataMigration{Name: name, RanAt: time.Now()}).Error; err != nil {
+		log.Printf("Error recording data migration %s: %v\n", name, err)
+	}
+}
+
+// Entries written before word counts were stored start at zero, and older
+// counts were taken from the raw text, markup included. Count every entry and
+// revision once with the current rules, which covers both.
+func recountWordCounts() error {
+	db := initialisers.DB
+
+	var entries []models.JournalEntry
+	if err := db.Unscoped().Select("id", "encrypted_content", "word_count").Find(&entries).Error; err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		content, err := models.Decrypt(entry.EncryptedContent)
+		if err != nil {
+			log.Printf("Entry %d could not be decrypted and keeps its word count\n", entry.ID)
+			continue
+		}
+
+		if wordCount := helper.CountWords(content); wordCount != entry.WordCount {
+			if err := db.Unscoped().Model(&entry).UpdateColumn("word_count", wordCount).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var revisions []models.EntryRevision
+	if err := db.Unscoped().Select("id", "encrypted_content", "word_count").Find(&revisions).Error; err != nil {
+		return err
+	}
+
+	for _, revision := range revisions {
+		content, err := models.Decrypt(revision.EncryptedContent)
+		if err != nil {
+			log.Printf("Revision %d could not be decrypted and keeps its word count\n", revision.ID)
+			continue
+		}
+
+		if wordCount := helper.CountWords(content); wordCount != revision.WordCount {
+			if err := db.Unscoped().Model(&revision).UpdateColumn("word_count", wordCount).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Entries written before search existed, or while no search key was set, have
+// no tokens yet. Trashed entries are indexed when they are restored, and empty
+// ones have nothing to find. Without a key the backfill waits for a later start.
+func backfillSearchTokens() error {
+	db := initialisers.DB
+
+	if err := models.CheckSearchIndexKey(); err != nil {
+		return err
+	}
+
+	var entries []models.JournalEntry
+	if err := db.Where("word_count > 0").
+		Where("NOT EXISTS (SELECT 1 FROM search_tokens WHERE search_tokens.journal_entry_id = journal_entries.id)").
+		Find(&entries).Error; err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		content, err := models.Decrypt(entry.EncryptedContent)
+		if err != nil {
+			log.Printf("Entry %d could not be decrypted and is not indexed\n", entry.ID)
+			continue
+		}
+
+		tokens, err := models.SearchTokensFor(entry.UserID, helper.SearchTerms(content))
+		if err != nil {
+			return err
+		}
+
+		if err := models.ReplaceSearchTokens(db, entry, tokens); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Entries used to be keyed by the raw timestamp the client sent. Before the
+// unique (user_id, entry_date) index can be created every existing entry needs
+// its local calendar day, and days with more than one entry have to be merged.
+func prepareEntryDates() {
+	db := initialisers.DB
+	migrator := db.Migrator()
+
+	if !migrator.HasTable(&models.JournalEntry{}) {
+		return
+	}
+
+	if !migrator.HasColumn(&models.JournalEntry{}, "EntryDate") {
+		log.Println("Backfilling entry dates")
+		if err := db.Exec("ALTER TABLE journal_entries ADD COLUMN entry_date date").Error; err != nil {
+			log.Println("Error adding entry_date column:", err)
+			return
+		}
+
+		if err := db.Exec(`UPDATE journal_entries SET entry_date = (journal_entries.date AT TIME ZONE users.time_zone)::date
+			FROM users WHERE users.id = journal_entries.user_id`).Error; err != nil {
+			log.Println("Error backfilling entry dates:", err)
+			return
+		}
+	}
+
+	// The (user_id, date) index of the same name is rebuilt on entry_date, which
+	// is what date range queries filter on now.
+	var oldIndexes int64
+	if err := db.Raw(`SELECT COUNT(*) FROM pg_indexes WHERE tablename = 'journal_entries'
+		AND indexname = 'idx_journal_entries_user_date' AND indexdef NOT LIKE '%entry_date%'`).Scan(&oldIndexes).Error; err != nil {
+		log.Println("Error checking the entry date index:", err)
+	} else if oldIndexes > 0 {
+		migrator.DropIndex(&models.JournalEntry{}, "idx_journal_entries_user_date")
+	}
+
+	// Once entries belong to notebooks the unique index already rules out duplicates,
+	// and two entries on one day in different notebooks must not be merged.
+	if !migrator.HasColumn(&models.JournalEntry{}, "NotebookID") {
+		mergeDuplicateEntries()
+	}
+}
+
+// Entries written before notebooks existed all move to their user's default
+// notebook, and the old one-entry-per-day index makes way for one per notebook.
+// It all happens in one transaction, and the server does not start if it fails,
+// so entries are never left without a notebook.
+func prepareNotebooks() error {
+	db := initialisers.DB
+
+	if !db.Migrator().HasTable(&models.JournalEntry{}) {
+		return nil
+	}
+
+	if err := db.AutoMigrate(&models.Notebook{}); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+
+		if !migrator.HasColumn(&models.JournalEntry{}, "NotebookID") {
+			log.Println("Moving entries into default notebooks")
+			if err := tx.Exec("ALTER TABLE journal_entries ADD COLUMN notebook_id bigint").Error; err != nil {
+				return err
+			}
+		}
+
+		// Also picks up entries an earlier, interrupted run left without a notebook.
+		if err := moveToDefaultNotebooks(tx, "journal_entries"); err != nil {
+			return err
+		}
+
+		if migrator.HasIndex(&models.JournalEntry{}, "idx_user_entry_date") {
+			return migrator.DropIndex(&models.JournalEntry{}, "idx_user_entry_date")
+		}
+		return nil
+	})
+}
+
+// Drafts used to be kept per day only. They belong to the default notebook,
+// which is where entries went when they were saved.
+func prepareDrafts() error {
+	db := initialisers.DB
+
+	if !db.Migrator().HasTable(&models.Draft{}) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+
+		if !migrator.HasColumn(&models.Draft{}, "NotebookID") {
+			if err := tx.Exec("ALTER TABLE drafts ADD COLUMN notebook_id bigint").Error; err != nil {
+				return err
+			}
+		}
+
+		if err := moveToDefaultNotebooks(tx, "drafts"); err != nil {
+			return err
+		}
+
+		if migrator.HasIndex(&models.Draft{}, "unique_user_draft_date") {
+			return migrator.DropIndex(&models.Draft{}, "unique_user_draft_date")
+		}
+		return nil
+	})
+}
+
+// moveToDefaultNotebooks puts every row of table that has no notebook yet,
+// trashed ones included, into its user's default notebook.
+func moveToDefaultNotebooks(tx *gorm.DB, table string) error {
+	var userIDs []uint
+	if err := tx.Table(table).Where("notebook_id IS NULL").Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		notebook, err := models.DefaultNotebook(tx, userID)
+		if err != nil {
+			return fmt.Errorf("creating default notebook for user %d: %w", userID, err)
+		}
+
+		if err := tx.Exec("UPDATE "+table+" SET notebook_id = ? WHERE user_id = ? AND notebook_id IS NULL", notebook.ID, userID).Error; err != nil {
+			return fmt.Errorf("moving %s of user %d into their notebook: %w", table, userID, err)
+		}
+	}
+	return nil
+}
+
+// mergeDuplicateEntries folds every extra entry on a day into the earliest readable one
+// and moves the extras to the trash, so nothing written is lost.
+func mergeDuplicateEntries() {
+	db := initialisers.DB
+
+	type duplicateDay struct {
+		UserID    uint
+		EntryDate time.Time
+		Count     int
+	}
+
+	var duplicates []duplicateDay
+	if err := db.Model(&models.JournalEntry{}).
+		Select("user_id, entry_date, COUNT(*) AS count").
+		Group("user_id, entry_date").
+		Having("COUNT(*) > 1").
+		Scan(&duplicates).Error; err != nil {
+		log.Println("Error looking for duplicate entries:", err)
+		return
+	}
+
+	if len(duplicates) > 0 {
+		log.Printf("Found %d days with more than one entry\n", len(duplicates))
+	}
+
+	for _, duplicate := range duplicates {
+		var entries []models.JournalEntry
+		if err := db.Where("user_id = ? AND entry_date = ?", duplicate.UserID, duplicate.EntryDate).
+			Order("created_at ASC").Order("id ASC").
+			Find(&entries).Error; err != nil {
+			log.Printf("Error loading duplicate entries for user %d: %v\n", duplicate.UserID, err)
+			continue
+		}
+
+		keptIndex := -1
+		contents := []string{}
+
+		for i, entry := range entries {
+			content, err := models.Decrypt(entry.EncryptedContent)
+			if err != nil {
+				log.Printf("Entry %d could not be decrypted and is not merged\n", entry.ID)
+				continue
+			}
+
+			contents = append(contents, content)
+			if keptIndex == -1 {
+				keptIndex = i
+			}
+		}
+
+		// Nothing could be decrypted, keep the earliest entry untouched.
+		if keptIndex == -1 {
+			keptIndex = 0
+		}
+
+		kept := entries[keptIndex]
+		extras := []uint{}
+		for _, entry := range entries {
+			if entry.ID != kept.ID {
+				extras = append(extras, entry.ID)
+			}
+		}
+
+		if len(contents) > 0 {
+			merged := strings.Join(contents, "\n\n")
+			encryptedContent, err := models.Encrypt(merged)
+			if err != nil {
+				log.Printf("Error encrypting merged entry %d: %v\n", kept.ID, err)
+				continue
+			}
+
+			if err := db.Model(&kept).UpdateColumns(map[string]interface{}{
+				"encrypted_content": encryptedContent,
+				"word_count":        helper.CountWords(merged),
+			}).Error; err != nil {
+				log.Printf("Error saving merged entry %d: %v\n", kept.ID, err)
+				continue
+			}
+		}
+
+		if err := db.Delete(&models.JournalEntry{}, extras).Error; err != nil {
+			log.Printf("Error trashing duplicate entries %v: %v\n", extras, err)
+			continue
+		}
+
+		log.Printf("Merged entries %v into entry %d for user %d on %s\n",
+			extras, kept.ID, duplicate.UserID, duplicate.EntryDate.Format("2006-01-02"))
+	}
 }
@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"bufio"
+	"daily-150/initialisers"
+	"daily-150/models"
+	_ "embed"
+	"log"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// One writing prompt per line. New lines are added to the library on the next
+// start; removing a line does not remove the prompt, since entries may refer to it.
+//
+//go:embed prompts.txt
+var promptsFile string
+
+func seedPrompts() {
+	prompts := []models.Prompt{}
+	scanner := bufio.NewScanner(strings.NewReader(promptsFile))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		prompts = append(prompts, models.Prompt{Text: text})
+	}
+
+	if len(prompts) == 0 {
+		return
+	}
+
+	if err := initialisers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "text"}},
+		DoNothing: true,
+	}).Create(&prompts).Error; err != nil {
+		log.Println("Error seeding prompts:", err)
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"context"
+	"daily-150/storage"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// DeleteEntryAttachments removes the stored files of the given entries'
+// attachments along with their rows. It has to run before the entries are
+// deleted for good, since the cascade only removes the rows.
+func DeleteEntryAttachments(db *gorm.DB, store storage.BlobStore, entryIDs []uint) error {
+	if len(entryIDs) == 0 {
+		return nil
+	}
+
+	var attachments []Attachment
+	if err := db.Unscoped().Where("journal_entry_id IN ?", entryIDs).Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, attachment := range attachments {
+		if err := store.Delete(ctx, attachment.StorageKey); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+			return err
+		}
+	}
+
+	return db.Unscoped().Where("journal_entry_id IN ?", entryIDs).Delete(&Attachment{}).Error
+}
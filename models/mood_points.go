@@ -0,0 +1,42 @@
+package models
+
+// MoodPoints turns entries, ordered by entry date, into their mood series with
+// one point per day, leaving out days with no rating at all. When several
+// notebooks rated the same day, the day gets the average of their ratings.
+func MoodPoints(entries []JournalEntry) []MoodPoint {
+	points := []MoodPoint{}
+	var mood, energy dayRatings
+	for i, entry := range entries {
+		mood.add(entry.Mood)
+		energy.add(entry.Energy)
+
+		date := entry.EntryDate.Format("2006-01-02")
+		if i+1 < len(entries) && entries[i+1].EntryDate.Format("2006-01-02") == date {
+			continue
+		}
+		if mood.count > 0 || energy.count > 0 {
+			points = append(points, MoodPoint{Date: date, Mood: mood.average(), Energy: energy.average()})
+		}
+		mood, energy = dayRatings{}, dayRatings{}
+	}
+	return points
+}
+
+type dayRatings struct {
+	sum, count int
+}
+
+func (r *dayRatings) add(rating *int) {
+	if rating != nil {
+		r.sum += *rating
+		r.count++
+	}
+}
+
+func (r dayRatings) average() *float64 {
+	if r.count == 0 {
+		return nil
+	}
+	average := float64(r.sum) / float64(r.count)
+	return &average
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The name given to the notebook every user starts with.
+const DefaultNotebookName = "Journal"
+
+// DefaultNotebook returns the user's default notebook, creating it the first
+// time it is needed.
+func DefaultNotebook(db *gorm.DB, userID uint) (Notebook, error) {
+	var notebook Notebook
+	err := db.Where("user_id = ? AND is_default", userID).First(&notebook).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return notebook, err
+	}
+
+	encryptedName, err := Encrypt(DefaultNotebookName)
+	if err != nil {
+		return Notebook{}, err
+	}
+
+	// Another request may have created it in the meantime; that one is kept.
+	if err := db.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "user_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "is_default AND deleted_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(&Notebook{
+		UserID:           userID,
+		EncryptedName:    encryptedName,
+		IsDefault:        true,
+		CountsTowardGoal: true,
+		IncludeInSummary: true,
+	}).Error; err != nil {
+		return Notebook{}, err
+	}
+
+	err = db.Where("user_id = ? AND is_default", userID).First(&notebook).Error
+	return notebook, err
+}
+
+// GoalNotebooks selects the IDs of the user's notebooks whose entries count
+// toward the daily word goal, for use as a subquery.
+func GoalNotebooks(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&Notebook{}).Select("id").Where("user_id = ? AND counts_toward_goal", userID)
+}
+
+// GoalWordsOn is how many words the user wrote on a day in notebooks that
+// count toward the goal.
+func GoalWordsOn(db *gorm.DB, userID uint, date time.Time) (int, error) {
+	var words int
+	err := db.Model(&JournalEntry{}).
+		Where("user_id = ? AND entry_date = ?", userID, date).
+		Where("notebook_id IN (?)", GoalNotebooks(db, userID)).
+		Select("COALESCE(SUM(word_count), 0)").
+		Scan(&words).Error
+	return words, err
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PickPrompt chooses a prompt for the user's day. The choice only depends on
+// the user, the day and how many times it was skipped, so asking again gives the
+// same prompt. A prompt with ID exclude is passed over when there is another one.
+func PickPrompt(db *gorm.DB, userID uint, date time.Time, skips int, exclude uint) (Prompt, error) {
+	var count int64
+	if err := db.Model(&Prompt{}).Count(&count).Error; err != nil {
+		return Prompt{}, err
+	}
+	if count == 0 {
+		return Prompt{}, gorm.ErrRecordNotFound
+	}
+
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d:%s:%d", userID, date.Format("2006-01-02"), skips)
+	index := int(hash.Sum64() % uint64(count))
+
+	var prompt Prompt
+	if err := db.Order("id ASC").Offset(index).First(&prompt).Error; err != nil {
+		return Prompt{}, err
+	}
+
+	if prompt.ID == exclude && count > 1 {
+		index = (index + 1) % int(count)
+		if err := db.Order("id ASC").Offset(index).First(&prompt).Error; err != nil {
+			return Prompt{}, err
+		}
+	}
+
+	return prompt, nil
+}
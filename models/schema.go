@@ -19,16 +19,149 @@ type User struct {
 	gorm.Model
 	Username       string         `gorm:"uniqueIndex;not null;size:255" json:"username"`
 	Password       string         `gorm:"not null;size:255" json:"-"`
+	TimeZone       string         `gorm:"not null;size:64;default:UTC" json:"time_zone"`
 	JournalEntries []JournalEntry `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"journal_entries"`
 	Summaries      []Summary      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"summaries"`
+	WordGoals      []WordGoal     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"word_goals,omitempty"`
+	Drafts         []Draft        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Tags           []Tag          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	DailyPrompts   []DailyPrompt  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Templates      []Template     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Notebooks      []Notebook     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
 }
 
+// A separate stream of entries, such as a work log or a dream journal. Every
+// user has one default notebook that entries go to unless another is chosen.
+// Names are encrypted, so uniqueness per user is checked in the application.
+type Notebook struct {
+	gorm.Model
+	UserID           uint   `gorm:"not null;index;uniqueIndex:idx_user_default_notebook,where:is_default AND deleted_at IS NULL" json:"user_id"`
+	EncryptedName    string `gorm:"not null" json:"-"`
+	IsDefault        bool   `gorm:"not null" json:"is_default"`
+	CountsTowardGoal bool   `gorm:"not null" json:"counts_toward_goal"`
+	IncludeInSummary bool   `gorm:"not null" json:"include_in_summary"`
+}
+
+// A user has at most one live entry per notebook and local calendar day.
+// EntryDate holds that day and Date the instant it starts in the user's time zone.
 type JournalEntry struct {
 	gorm.Model
-	UserID           uint      `gorm:"not null" json:"user_id"`
-	Date             time.Time `gorm:"not null" json:"date"`
-	EncryptedContent string    `gorm:"not null" json:"content"`
+	UserID           uint            `gorm:"not null;uniqueIndex:idx_user_notebook_entry_date;index:idx_journal_entries_user_date" json:"user_id"`
+	NotebookID       uint            `gorm:"not null;uniqueIndex:idx_user_notebook_entry_date" json:"notebook_id"`
+	Notebook         *Notebook       `gorm:"constraint:OnDelete:RESTRICT;" json:"-"`
+	Date             time.Time       `gorm:"not null" json:"date"`
+	EntryDate        time.Time       `gorm:"type:date;not null;uniqueIndex:idx_user_notebook_entry_date,where:deleted_at IS NULL;index:idx_journal_entries_user_date" json:"entry_date"`
+	EncryptedContent string          `gorm:"not null" json:"content"`
+	WordCount        int             `gorm:"not null;default:0" json:"word_count"`
+	Version          uint            `gorm:"not null;default:1" json:"version"`
+	Mood             *int            `gorm:"check:mood BETWEEN 1 AND 5" json:"mood"`
+	Energy           *int            `gorm:"check:energy BETWEEN 1 AND 5" json:"energy"`
+	PromptID         *uint           `gorm:"index" json:"prompt_id"`
+	Prompt           *Prompt         `gorm:"constraint:OnDelete:SET NULL;" json:"-"`
+	Revisions        []EntryRevision `gorm:"foreignKey:JournalEntryID;constraint:OnDelete:CASCADE;" json:"-"`
+	Tags             []Tag           `gorm:"many2many:entry_tags;constraint:OnDelete:CASCADE;" json:"-"`
+	SearchTokens     []SearchToken   `gorm:"foreignKey:JournalEntryID;constraint:OnDelete:CASCADE;" json:"-"`
+	Attachments      []Attachment    `gorm:"foreignKey:JournalEntryID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// A file attached to an entry. The file itself is encrypted with EncryptBytes
+// and kept in the blob store under StorageKey; Size is its unencrypted size and
+// is what counts towards the user's quota.
+type Attachment struct {
+	gorm.Model
+	UserID         uint   `gorm:"not null;index" json:"user_id"`
+	JournalEntryID uint   `gorm:"not null;index" json:"entry_id"`
+	EncryptedName  string `gorm:"not null" json:"-"`
+	ContentType    string `gorm:"not null;size:255" json:"content_type"`
+	Size           int64  `gorm:"not null" json:"size"`
+	StorageKey     string `gorm:"not null;uniqueIndex;size:255" json:"-"`
+}
+
+// A blind index entry: the keyed hash of one distinct word in an entry. The
+// words themselves are never stored, but an entry containing a word can still
+// be found by hashing the search term the same way.
+type SearchToken struct {
+	ID             uint   `gorm:"primaryKey"`
+	JournalEntryID uint   `gorm:"not null;index"`
+	UserID         uint   `gorm:"not null;index:idx_search_tokens_user_token"`
+	Token          string `gorm:"not null;size:64;index:idx_search_tokens_user_token"`
+}
+
+// A writing prompt from the shared library. Prompts are seeded at start-up from
+// the file embedded in the migrate package.
+type Prompt struct {
+	gorm.Model
+	Text string `gorm:"not null;uniqueIndex" json:"text"`
+}
+
+// The prompt a user was given for a day. It is picked once and kept, so it does
+// not change when the library grows; Skips counts how often it was rerolled.
+type DailyPrompt struct {
+	gorm.Model
+	UserID     uint      `gorm:"not null;uniqueIndex:unique_user_prompt_date" json:"user_id"`
+	PromptDate time.Time `gorm:"type:date;not null;uniqueIndex:unique_user_prompt_date" json:"prompt_date"`
+	PromptID   uint      `gorm:"not null" json:"prompt_id"`
+	Prompt     Prompt    `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Skips      int       `gorm:"not null;default:0" json:"skips"`
+}
+
+// Tag names are encrypted like entry content, so uniqueness per user is
+// checked in the application rather than by an index.
+type Tag struct {
+	gorm.Model
+	UserID        uint   `gorm:"not null;index" json:"user_id"`
+	EncryptedName string `gorm:"not null" json:"-"`
+}
+
+// A user's skeleton for structured entries. Both the name and the body are
+// encrypted; the body may contain placeholders such as {{date}} that are filled
+// in when an entry is created from it.
+type Template struct {
+	gorm.Model
+	UserID           uint   `gorm:"not null;index" json:"user_id"`
+	EncryptedName    string `gorm:"not null" json:"-"`
+	EncryptedContent string `gorm:"not null" json:"-"`
+}
+
+// A snapshot of an entry's content taken just before it was overwritten.
+// Revisions are numbered from 1 per entry.
+type EntryRevision struct {
+	gorm.Model
+	JournalEntryID   uint   `gorm:"not null;uniqueIndex:unique_entry_revision" json:"entry_id"`
+	UserID           uint   `gorm:"not null;index" json:"user_id"`
+	Revision         uint   `gorm:"not null;uniqueIndex:unique_entry_revision" json:"revision"`
+	EncryptedContent string `gorm:"not null" json:"-"`
+	WordCount        int    `gorm:"not null;default:0" json:"word_count"`
+}
+
+// How long a draft is kept after it was last saved.
+const DraftTTL = 7 * 24 * time.Hour
+
+// Unsaved editor content for a day in a notebook, kept until the entry is committed
+// or DraftTTL has passed. Drafts live in Redis with that TTL and are mirrored
+// here in case the cache is lost; the purge routine expires them here.
+type Draft struct {
+	gorm.Model
+	UserID           uint      `gorm:"not null;uniqueIndex:unique_user_notebook_draft_date" json:"user_id"`
+	NotebookID       uint      `gorm:"not null;uniqueIndex:unique_user_notebook_draft_date" json:"notebook_id"`
+	Notebook         *Notebook `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	DraftDate        time.Time `gorm:"type:date;not null;uniqueIndex:unique_user_notebook_draft_date" json:"draft_date"`
+	EncryptedContent string    `gorm:"not null" json:"-"`
 }
+
+// The number of words a user has to write for a day to count as journaled,
+// unless they have set a goal of their own.
+const DailyWordGoal = 150
+
+// A daily word goal applies from EffectiveFrom until the next goal starts,
+// so changing the goal never rewrites past days.
+type WordGoal struct {
+	gorm.Model
+	UserID        uint      `gorm:"not null;uniqueIndex:unique_user_goal_date" json:"user_id"`
+	Goal          int       `gorm:"not null" json:"goal"`
+	EffectiveFrom time.Time `gorm:"type:date;not null;uniqueIndex:unique_user_goal_date" json:"effective_from"`
+}
+
 type Summary struct {
 	gorm.Model
 	UserID     uint   `gorm:"not null;uniqueIndex:unique_user_week_year" json:"user_id"`
@@ -37,12 +170,45 @@ type Summary struct {
 	Summary    string `gorm:"not null" json:"summary"`
 }
 
+// A one-off data migration that has finished, so it is not run again on the
+// next start.
+type DataMigration struct {
+	Name  string    `gorm:"primaryKey;size:255"`
+	RanAt time.Time `gorm:"not null"`
+}
+
 // Only for the code and not an actual relation in the database.
 type SummaryTask struct {
-	UserID  uint     `json:"user_id"`
-	Entries []string `json:"entries"`
+	UserID  uint        `json:"user_id"`
+	Entries []string    `json:"entries"`
+	Moods   []MoodPoint `json:"moods,omitempty"`
+
+	// The week the entries were written in, Monday to Sunday, and its ISO
+	// year and week number, which the summary is saved under.
+	WeekStart string `json:"week_start"`
+	WeekEnd   string `json:"week_end"`
+	Year      int    `json:"year"`
+	Week      int    `json:"week"`
+
+	// How many times summarising this task has failed, and why it last did.
+	Attempts  int        `json:"attempts,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+}
+
+// One day's mood and energy ratings, each from 1 to 5 when set and averaged
+// over the day's notebooks.
+type MoodPoint struct {
+	Date   string   `json:"date"`
+	Mood   *float64 `json:"mood,omitempty"`
+	Energy *float64 `json:"energy,omitempty"`
 }
 
+const (
+	MinMoodRating = 1
+	MaxMoodRating = 5
+)
+
 func getEncryptionKey() ([]byte, error) {
 	key := os.Getenv("JOURNAL_ENCRYPTION_KEY")
 	if key == "" {
@@ -68,75 +234,92 @@ func getEncryptionKey() ([]byte, error) {
 }
 
 func Encrypt(text string) (string, error) {
-	key, err := getEncryptionKey()
+	ciphertext, err := EncryptBytes([]byte(text))
 	if err != nil {
 		return "", err
 	}
 
-	plaintext := []byte(text)
+	encodedCiphertext := base64.StdEncoding.EncodeToString(ciphertext)
+
+	return encodedCiphertext, nil
+}
+
+// EncryptBytes seals data with AES-GCM and prepends the nonce. Encrypt is the
+// same scheme with the result base64 encoded for storing as text.
+func EncryptBytes(plaintext []byte) ([]byte, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		log.Printf("ERROR: failed to create cipher block: %v\n", err)
-		return "", err
+		return nil, err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
 		log.Printf("ERROR: failed to create GCM: %v\n", err)
-		return "", err
+		return nil, err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		log.Printf("ERROR: failed to read nonce: %v\n", err)
-		return "", err
+		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	encodedCiphertext := base64.StdEncoding.EncodeToString(ciphertext)
-
-	return encodedCiphertext, nil
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
 }
 
 func Decrypt(encryptedText string) (string, error) {
-
-	key, err := getEncryptionKey()
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
 	if err != nil {
+		log.Printf("ERROR: failed to decode base64 ciphertext: %v\n", err)
 		return "", err
 	}
 
-	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
+	plaintext, err := DecryptBytes(ciphertext)
 	if err != nil {
-		log.Printf("ERROR: failed to decode base64 ciphertext: %v\n", err)
 		return "", err
 	}
 
+	decryptedText := string(plaintext)
+
+	return decryptedText, nil
+}
+
+// DecryptBytes opens data sealed by EncryptBytes.
+func DecryptBytes(ciphertext []byte) ([]byte, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		log.Printf("ERROR: failed to create cipher block: %v\n", err)
-		return "", err
+		return nil, err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
 		log.Printf("ERROR: failed to create GCM: %v\n", err)
-		return "", err
+		return nil, err
 	}
 
 	if len(ciphertext) < gcm.NonceSize() {
 		log.Println("ERROR: ciphertext too short")
-		return "", errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 
 	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
 		log.Printf("ERROR: failed to decrypt text: %v\n", err)
-		return "", err
+		return nil, err
 	}
 
-	decryptedText := string(plaintext)
-
-	return decryptedText, nil
+	return plaintext, nil
 }
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Search tokens are keyed with their own secret so that leaking one key does
+// not weaken the other.
+func getSearchIndexKey() ([]byte, error) {
+	key := os.Getenv("SEARCH_INDEX_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("SEARCH_INDEX_KEY environment variable not set")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search index key format: %v", err)
+	}
+
+	if len(decoded) < 32 {
+		return nil, fmt.Errorf("search index key must be at least 32 bytes (got %d)", len(decoded))
+	}
+
+	return decoded, nil
+}
+
+// CheckSearchIndexKey reports whether SEARCH_INDEX_KEY holds a usable key, so
+// work that writes search tokens can stop before it starts.
+func CheckSearchIndexKey() error {
+	_, err := getSearchIndexKey()
+	return err
+}
+
+// SearchTokensFor hashes search terms into the user's blind index tokens. The
+// user ID is part of the hash, so the same word gives different tokens for
+// different users.
+func SearchTokensFor(userID uint, terms []string) ([]string, error) {
+	key, err := getSearchIndexKey()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strconv.FormatUint(uint64(userID), 10) + ":"
+	tokens := make([]string, 0, len(terms))
+	for _, term := range terms {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(prefix + term))
+		tokens = append(tokens, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	return tokens, nil
+}
+
+// ReplaceSearchTokens swaps the entry's stored tokens for the given ones.
+func ReplaceSearchTokens(db *gorm.DB, entry JournalEntry, tokens []string) error {
+	if err := db.Where("journal_entry_id = ?", entry.ID).Delete(&SearchToken{}).Error; err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	rows := make([]SearchToken, 0, len(tokens))
+	for _, token := range tokens {
+		rows = append(rows, SearchToken{
+			JournalEntryID: entry.ID,
+			UserID:         entry.UserID,
+			Token:          token,
+		})
+	}
+
+	return db.CreateInBatches(rows, 500).Error
+}
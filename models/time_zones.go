@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// Location returns the user's IANA time zone, falling back to UTC if it is unset or unknown.
+func (user User) Location() *time.Location {
+	if user.TimeZone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Today returns the user's current calendar day.
+func (user User) Today() time.Time {
+	return CalendarDate(time.Now(), user.Location())
+}
+
+// CalendarDate returns the calendar day t falls on in loc. Calendar days are
+// always represented as midnight UTC so they compare and format the same way
+// no matter which zone they came from.
+func CalendarDate(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfDay returns the instant a calendar day begins in loc.
+func StartOfDay(date time.Time, loc *time.Location) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// WeekStart returns the Monday of the ISO week containing date.
+func WeekStart(date time.Time) time.Time {
+	offset := (int(date.Weekday()) + 6) % 7
+	return date.AddDate(0, 0, -offset)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WordGoals is a user's goal history ordered by EffectiveFrom.
+type WordGoals []WordGoal
+
+func LoadWordGoals(db *gorm.DB, userID uint) (WordGoals, error) {
+	var goals WordGoals
+	if err := db.Where("user_id = ?", userID).Order("effective_from ASC").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+	return goals, nil
+}
+
+// On returns the goal that applied on the calendar day of date.
+func (goals WordGoals) On(date time.Time) int {
+	day := date.Format("2006-01-02")
+	goal := DailyWordGoal
+	for _, g := range goals {
+		if g.EffectiveFrom.Format("2006-01-02") > day {
+			break
+		}
+		goal = g.Goal
+	}
+	return goal
+}
+
+func WordGoalOn(db *gorm.DB, userID uint, date time.Time) (int, error) {
+	goals, err := LoadWordGoals(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	return goals.On(date), nil
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+	"daily-150/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// These routes authenticate with ADMIN_API_KEY instead of a user's token.
+func AdminRouter(api fiber.Router) {
+	admin := api.Group("/admin", middlewares.CheckAdminKey())
+	admin.Get("/summary-tasks/dead", controllers.GetDeadSummaryTasks)
+	admin.Post("/summary-tasks/dead/requeue", controllers.RequeueDeadSummaryTasks)
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AttachmentRouter(api fiber.Router) {
+	api.Post("/entry/:id/attachments", controllers.UploadAttachment)
+	api.Get("/entry/:id/attachments", controllers.GetEntryAttachments)
+	api.Get("/attachments/:id", controllers.DownloadAttachment)
+	api.Delete("/attachments/:id", controllers.DeleteAttachment)
+}
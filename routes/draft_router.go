@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func DraftRouter(api fiber.Router) {
+	api.Put("/draft/:date", controllers.SaveDraft)
+	api.Get("/draft/:date", controllers.GetDraft)
+	api.Delete("/draft/:date", controllers.DeleteDraft)
+}
@@ -8,4 +8,12 @@ func IndexRouter(api fiber.Router) {
 	AuthRouter(api)
 	JournalRouter(api)
 	ExtensionRouter(api)
+	SettingsRouter(api)
+	DraftRouter(api)
+	TagRouter(api)
+	PromptRouter(api)
+	TemplateRouter(api)
+	AttachmentRouter(api)
+	NotebookRouter(api)
+	AdminRouter(api)
 }
@@ -12,7 +12,19 @@ func JournalRouter(api fiber.Router) {
 	api.Get("/entry/:id", controllers.GetEntryByID)
 	api.Patch("/entry/:id", controllers.UpdateEntry)
 	api.Delete("/entry/:id", controllers.DeleteEntry)
+	api.Get("/entry/:id/revisions", controllers.GetEntryRevisions)
+	api.Get("/entry/:id/revisions/diff", controllers.DiffEntryRevisions)
+	api.Get("/entry/:id/revisions/:rev", controllers.GetEntryRevision)
+	api.Post("/entry/:id/revisions/:rev/restore", controllers.RestoreEntryRevision)
+	api.Get("/trash", controllers.GetTrash)
+	api.Post("/trash/:id/restore", controllers.RestoreEntry)
+	api.Delete("/trash/:id", controllers.PurgeEntry)
 	api.Get("/generate-summary", controllers.GenerateWeeklySummary)
 	api.Get("/summaries", controllers.GetSummariesForUser)
 	api.Get("/summary/:id", controllers.GetSummaryByID)
+	api.Get("/stats", controllers.GetStats)
+	api.Get("/calendar", controllers.GetCalendar)
+	api.Get("/mood/trend", controllers.GetMoodTrend)
+	api.Get("/search", controllers.SearchEntries)
+	api.Get("/memories/today", controllers.GetMemoriesToday)
 }
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func NotebookRouter(api fiber.Router) {
+	api.Get("/notebooks", controllers.GetNotebooks)
+	api.Post("/notebooks", controllers.CreateNotebook)
+	api.Patch("/notebooks/:id", controllers.UpdateNotebook)
+	api.Delete("/notebooks/:id", controllers.DeleteNotebook)
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func PromptRouter(api fiber.Router) {
+	api.Get("/prompt/today", controllers.GetTodaysPrompt)
+	api.Post("/prompt/today/skip", controllers.SkipTodaysPrompt)
+}
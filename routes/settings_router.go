@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SettingsRouter(api fiber.Router) {
+	api.Get("/settings", controllers.GetSettings)
+	api.Patch("/settings", controllers.UpdateSettings)
+	api.Get("/settings/word-goals", controllers.GetWordGoalHistory)
+}
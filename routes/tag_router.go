@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TagRouter(api fiber.Router) {
+	api.Get("/tags", controllers.GetTags)
+	api.Post("/tags", controllers.CreateTag)
+	api.Patch("/tags/:id", controllers.UpdateTag)
+	api.Delete("/tags/:id", controllers.DeleteTag)
+}
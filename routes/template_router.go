@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controllers "daily-150/controller"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TemplateRouter(api fiber.Router) {
+	api.Get("/templates", controllers.GetTemplates)
+	api.Post("/templates", controllers.CreateTemplate)
+	api.Get("/templates/:id", controllers.GetTemplate)
+	api.Get("/templates/:id/render", controllers.RenderTemplate)
+	api.Patch("/templates/:id", controllers.UpdateTemplate)
+	api.Delete("/templates/:id", controllers.DeleteTemplate)
+}
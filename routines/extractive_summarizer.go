@@ -0,0 +1,187 @@
+package routines
+
+import (
+	"context"
+	"daily-150/helper"
+	"daily-150/models"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// How many sentences the extractive summariser keeps when SUMMARISER=extractive.
+const defaultSummarySentences = 5
+
+// Sentences shorter than this are rarely worth repeating back in a summary.
+const minSummarySentenceWords = 4
+
+var sentenceEnd = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+
+// Common words that say nothing about what a week was about.
+var stopWords = map[string]bool{
+	"a": true, "about": true, "after": true, "again": true, "all": true, "am": true, "an": true, "and": true,
+	"any": true, "are": true, "as": true, "at": true, "be": true, "been": true, "before": true, "but": true,
+	"by": true, "can": true, "could": true, "did": true, "do": true, "does": true, "don't": true, "for": true,
+	"from": true, "got": true, "had": true, "has": true, "have": true, "he": true, "her": true, "him": true,
+	"his": true, "how": true, "i": true, "i'm": true, "i've": true, "if": true, "in": true, "into": true,
+	"is": true, "it": true, "it's": true, "its": true, "just": true, "me": true, "more": true, "my": true,
+	"no": true, "not": true, "of": true, "on": true, "one": true, "or": true, "our": true, "out": true,
+	"really": true, "she": true, "so": true, "some": true, "than": true, "that": true, "the": true,
+	"their": true, "them": true, "then": true, "there": true, "they": true, "this": true, "to": true,
+	"today": true, "too": true, "up": true, "us": true, "very": true, "was": true, "we": true, "were": true,
+	"what": true, "when": true, "which": true, "who": true, "will": true, "with": true, "would": true,
+	"you": true, "your": true,
+}
+
+// ExtractiveSummarizer builds a summary in-process by picking the sentences
+// that share the most words with the rest of the week. It needs no network and
+// always gives the same summary for the same input, which makes it suitable for
+// offline development and tests.
+type ExtractiveSummarizer struct {
+	sentences int
+}
+
+func NewExtractiveSummarizer(sentences int) *ExtractiveSummarizer {
+	if sentences < 1 {
+		sentences = 1
+	}
+	return &ExtractiveSummarizer{sentences: sentences}
+}
+
+type scoredSentence struct {
+	text     string
+	position int
+	score    float64
+}
+
+func (s *ExtractiveSummarizer) Summarize(ctx context.Context, inputs map[uint]SummaryInput) (map[uint]string, error) {
+	result := make(map[uint]string, len(inputs))
+	for userID, input := range inputs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result[userID] = s.summarizeUser(input)
+	}
+	return result, nil
+}
+
+func (s *ExtractiveSummarizer) summarizeUser(input SummaryInput) string {
+	sentences := []scoredSentence{}
+	sentenceTerms := [][]string{}
+	frequency := map[string]int{}
+
+	for _, entry := range input.Entries {
+		for _, text := range splitSentences(entry) {
+			if helper.CountWords(text) < minSummarySentenceWords {
+				continue
+			}
+
+			terms := contentTerms(text)
+			for _, term := range terms {
+				frequency[term]++
+			}
+			sentences = append(sentences, scoredSentence{text: text, position: len(sentences)})
+			sentenceTerms = append(sentenceTerms, terms)
+		}
+	}
+
+	for i, terms := range sentenceTerms {
+		if len(terms) == 0 {
+			continue
+		}
+		total := 0
+		for _, term := range terms {
+			total += frequency[term]
+		}
+		sentences[i].score = float64(total) / float64(len(terms))
+	}
+
+	ranked := append([]scoredSentence(nil), sentences...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+	if len(ranked) > s.sentences {
+		ranked = ranked[:s.sentences]
+	}
+
+	// Read back in the order they were written.
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].position < ranked[j].position
+	})
+
+	parts := make([]string, 0, len(ranked)+1)
+	for _, sentence := range ranked {
+		parts = append(parts, sentence.text)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "Not much was written this week.")
+	}
+	if line := moodSummaryLine(input.Moods); line != "" {
+		parts = append(parts, line)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// splitSentences breaks an entry into sentences, treating line breaks as
+// sentence breaks too since journal entries are often written as lists.
+func splitSentences(text string) []string {
+	sentences := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		start := 0
+		for _, match := range sentenceEnd.FindAllStringIndex(line, -1) {
+			sentences = appendSentence(sentences, line[start:match[1]])
+			start = match[1]
+		}
+		sentences = appendSentence(sentences, line[start:])
+	}
+	return sentences
+}
+
+func appendSentence(sentences []string, sentence string) []string {
+	sentence = strings.TrimSpace(sentence)
+	if sentence == "" {
+		return sentences
+	}
+	return append(sentences, sentence)
+}
+
+func contentTerms(text string) []string {
+	terms := []string{}
+	for _, term := range helper.SearchTerms(text) {
+		if !stopWords[term] {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func moodSummaryLine(moods []models.MoodPoint) string {
+	mood, moodDays := 0.0, 0
+	energy, energyDays := 0.0, 0
+	for _, point := range moods {
+		if point.Mood != nil {
+			mood += *point.Mood
+			moodDays++
+		}
+		if point.Energy != nil {
+			energy += *point.Energy
+			energyDays++
+		}
+	}
+
+	parts := []string{}
+	if moodDays > 0 {
+		parts = append(parts, fmt.Sprintf("mood averaged %.1f out of %d", mood/float64(moodDays), models.MaxMoodRating))
+	}
+	if energyDays > 0 {
+		parts = append(parts, fmt.Sprintf("energy averaged %.1f out of %d", energy/float64(energyDays), models.MaxMoodRating))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	line := strings.Join(parts, " and ") + "."
+	return strings.ToUpper(line[:1]) + line[1:]
+}
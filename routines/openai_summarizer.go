@@ -0,0 +1,144 @@
+package routines
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const summarySystemPrompt = "You summarise a week of someone's private journal. " +
+	"Write a short, warm summary in the second person of what they did, thought and felt. " +
+	"Do not invent details that are not in the entries."
+
+// OpenAISummarizer summarises each user with a chat completion request to an
+// OpenAI-compatible endpoint, which is what local model servers such as Ollama
+// expose. baseURL is the part before /chat/completions, e.g. http://localhost:11434/v1.
+type OpenAISummarizer struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func NewOpenAISummarizer(baseURL, model, apiKey string) (*OpenAISummarizer, error) {
+	if baseURL == "" {
+		return nil, errors.New("SUMMARY_LLM_URL is not set")
+	}
+	if model == "" {
+		return nil, errors.New("SUMMARY_LLM_MODEL is not set")
+	}
+
+	return &OpenAISummarizer{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		client: &http.Client{
+			// Local models can be slow to answer on modest hardware.
+			Timeout: 300 * time.Second,
+		},
+	}, nil
+}
+
+func (s *OpenAISummarizer) Summarize(ctx context.Context, inputs map[uint]SummaryInput) (map[uint]string, error) {
+	result := make(map[uint]string, len(inputs))
+	for userID, input := range inputs {
+		summary, err := s.summarizeUser(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("summarising user %d: %w", userID, err)
+		}
+		result[userID] = summary
+	}
+	return result, nil
+}
+
+func (s *OpenAISummarizer) summarizeUser(ctx context.Context, input SummaryInput) (string, error) {
+	payload, err := json.Marshal(chatRequest{
+		Model: s.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: summarySystemPrompt},
+			{Role: "user", Content: summaryPrompt(input)},
+		},
+		Temperature: 0.3,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/chat/completions", bytes.NewBuffer(payload))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("chat completion returned %s", resp.Status)
+	}
+
+	var completion chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("chat completion returned no choices")
+	}
+
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
+
+// summaryPrompt lays out one user's week for the model.
+func summaryPrompt(input SummaryInput) string {
+	var prompt strings.Builder
+	prompt.WriteString("Here are this week's journal entries.\n")
+
+	for i, entry := range input.Entries {
+		fmt.Fprintf(&prompt, "\nEntry %d:\n%s\n", i+1, entry)
+	}
+
+	if len(input.Moods) > 0 {
+		prompt.WriteString("\nMood and energy ratings (1 to 5):\n")
+		for _, point := range input.Moods {
+			fmt.Fprintf(&prompt, "- %s: mood %s, energy %s\n", point.Date, ratingText(point.Mood), ratingText(point.Energy))
+		}
+	}
+
+	return prompt.String()
+}
+
+func ratingText(rating *float64) string {
+	if rating == nil {
+		return "not given"
+	}
+	return fmt.Sprint(*rating)
+}
@@ -1,160 +1,366 @@
 package routines
 
 import (
-	"bytes"
 	"context"
+	"daily-150/helper"
 	"daily-150/initialisers"
 	"daily-150/models"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"net/http"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm/clause"
 )
 
-func ProcessSummaries() {
+// A message left pending this long belongs to a worker that has most likely
+// died, so another worker takes it over. A batch can take far longer than this
+// to summarise, so a live worker renews its claim on the batch every
+// summaryClaimRenewal, which resets the messages' idle time.
+const (
+	summaryClaimIdle    = 15 * time.Minute
+	summaryClaimRenewal = summaryClaimIdle / 3
+)
+
+// How long a batch that is in flight at shutdown gets to finish before it is
+// cut off and its tasks are put back on the stream.
+const summaryShutdownGrace = 20 * time.Second
+
+// Number of users to process in one API call
+const summaryBatchSize = 10
+
+// A task read from the stream, with the message ID it has to be acknowledged by.
+type queuedTask struct {
+	messageID string
+	task      models.SummaryTask
+}
+
+// ProcessSummaries runs SUMMARY_WORKERS workers against the summary stream and
+// returns once ctx is cancelled and every one of them has stopped.
+func ProcessSummaries(ctx context.Context) {
 	log.Println("PROCESSING SUMMARIES ROUTINE ACTIVE")
-	ctx := context.Background()
-	queueName := "summary_tasks"
-	expressServerURL := os.Getenv("SUMMARY_SERVICE_URL")
-	SUMMARISER_KEY := os.Getenv("SUMMARISER_KEY")
-	db := initialisers.DB
-	redisClient := initialisers.RedisClient
 
-	if redisClient == nil {
+	if initialisers.RedisClient == nil {
 		log.Println("Redis client not initialised")
 		return
 	}
 
-	//Config for the worker.
-	// maxConcurrent := 5 // Maximum number of concurrent batches process
-	batchSize := 10 // Number of users to process in one API call
-	// retryLimit := 3    // Maximum number of retries for a failed task
+	summarizer, err := NewSummarizer()
+	if err != nil {
+		log.Println("Error setting up summariser: ", err)
+		return
+	}
+
+	if err := setUpSummaryStream(ctx); err != nil {
+		log.Println("Error setting up summary stream: ", err)
+		return
+	}
 
-	for {
-		batchTasks := []models.SummaryTask{}
+	consumer := summaryConsumerName()
+	workers := helper.SummaryWorkers()
+	log.Printf("STARTING %d SUMMARY WORKERS AS %s\n", workers, consumer)
 
-		//Get tasks until we get a batch or the queue is empty
-		for range batchSize {
-			result, err := redisClient.BLPop(ctx, 1*time.Second, queueName).Result()
-			if err != nil {
-				// If it's a timeout, just continue to the next iteration
-				if err == redis.Nil {
-					break
-				}
-				log.Println("Error getting task from Redis queue: ", err)
-				break
-			}
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runSummaryWorker(ctx, fmt.Sprintf("%s-%d", consumer, i), summarizer)
+		}()
+	}
 
-			// The result contains [queueName, value]
-			taskJSON := result[1]
+	wg.Wait()
+	log.Println("SUMMARY WORKERS STOPPED")
+}
 
-			var task models.SummaryTask
-			if err := json.Unmarshal([]byte(taskJSON), &task); err != nil {
-				log.Println("Error unmarshalling task: ", err)
-				continue
-			}
+func runSummaryWorker(ctx context.Context, consumer string, summarizer Summarizer) {
+	claimStart := "0-0"
 
-			batchTasks = append(batchTasks, task)
-		}
+	for ctx.Err() == nil {
+		promoteDueRetries(ctx)
 
+		batchTasks := readSummaryBatch(ctx, consumer, &claimStart)
 		if len(batchTasks) == 0 {
-			time.Sleep(5 * time.Second)
 			continue
 		}
 
-		// Process the batch
-		userEntries := make(map[uint][]string)
-		for _, task := range batchTasks {
-			userEntries[task.UserID] = task.Entries
+		stopRenewing := renewSummaryClaims(ctx, consumer, batchTasks)
+		batchCtx, cancel := shutdownGraceContext(ctx, summaryShutdownGrace)
+		processSummaryBatch(batchCtx, batchTasks, summarizer)
+		cancel()
+		stopRenewing()
+	}
+}
+
+// renewSummaryClaims claims the batch's messages for consumer again every
+// summaryClaimRenewal until the returned function is called, so no other worker
+// takes them over while the summariser is still working on them. Messages that
+// have been acknowledged in the meantime are no longer pending and are skipped.
+func renewSummaryClaims(ctx context.Context, consumer string, batchTasks []queuedTask) func() {
+	messageIDs := make([]string, 0, len(batchTasks))
+	for _, queued := range batchTasks {
+		messageIDs = append(messageIDs, queued.messageID)
+	}
+
+	// The batch may run on past shutdown for its grace period, so renewing does too.
+	renewCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(summaryClaimRenewal)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				if err := initialisers.RedisClient.XClaimJustID(renewCtx, &redis.XClaimArgs{
+					Stream:   SummaryStream,
+					Group:    SummaryGroup,
+					Consumer: consumer,
+					Messages: messageIDs,
+				}).Err(); err != nil && renewCtx.Err() == nil {
+					log.Printf("Error renewing claim on %d summary tasks: %v\n", len(messageIDs), err)
+				}
+			}
 		}
+	}()
 
-		// Send the batch to the Express server
-		payload, err := json.Marshal(userEntries)
-		if err != nil {
-			log.Printf("Error marshalling payload: %v\n", err)
-			// Put tasks back in the queue
-			for _, task := range batchTasks {
-				taskJSON, _ := json.Marshal(task)
-				redisClient.RPush(ctx, queueName, taskJSON)
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// readSummaryBatch takes over tasks a crashed worker left pending, then fills
+// the rest of the batch with new tasks, waiting a few seconds for some to arrive.
+func readSummaryBatch(ctx context.Context, consumer string, claimStart *string) []queuedTask {
+	redisClient := initialisers.RedisClient
+
+	messages, next, err := redisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   SummaryStream,
+		Group:    SummaryGroup,
+		Consumer: consumer,
+		MinIdle:  summaryClaimIdle,
+		Start:    *claimStart,
+		Count:    summaryBatchSize,
+	}).Result()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Println("Error claiming stale summary tasks: ", err)
+	} else {
+		*claimStart = next
+		if len(messages) > 0 {
+			log.Printf("Claimed %d stale summary tasks\n", len(messages))
+		}
+	}
+
+	if len(messages) < summaryBatchSize {
+		streams, err := redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    SummaryGroup,
+			Consumer: consumer,
+			Streams:  []string{SummaryStream, ">"},
+			Count:    int64(summaryBatchSize - len(messages)),
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil && err != redis.Nil && ctx.Err() == nil {
+			log.Println("Error reading from summary stream: ", err)
+			// The stream and its group are gone if Redis lost its data.
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				if err := setUpSummaryStream(ctx); err != nil {
+					log.Println("Error setting up summary stream: ", err)
+				}
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
 			}
+		}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+	}
+
+	batchTasks := []queuedTask{}
+	for _, message := range messages {
+		taskJSON, _ := message.Values[summaryTaskField].(string)
+
+		var task models.SummaryTask
+		if err := json.Unmarshal([]byte(taskJSON), &task); err != nil {
+			// It can never be processed, so keeping it pending would only have it claimed over and over.
+			log.Printf("Error unmarshalling task %s: %v\n", message.ID, err)
+			ackSummaryTask(context.WithoutCancel(ctx), message.ID)
 			continue
 		}
 
-		req, err := http.NewRequest("POST", expressServerURL, bytes.NewBuffer(payload))
-		if err != nil {
-			log.Printf("Error creating request: %v\n", err)
-			// Put tasks back in the queue
-			for _, task := range batchTasks {
-				taskJSON, _ := json.Marshal(task)
-				redisClient.RPush(ctx, queueName, taskJSON)
+		batchTasks = append(batchTasks, queuedTask{messageID: message.ID, task: task})
+	}
+
+	return batchTasks
+}
+
+// processSummaryBatch summarises a batch and saves the summaries. Should ctx be
+// cancelled before the summariser answers, the tasks go back on the stream
+// untouched for another worker to pick up.
+func processSummaryBatch(ctx context.Context, batchTasks []queuedTask, summarizer Summarizer) {
+	// The summariser takes one week per user, so a user with several weeks
+	// queued, as after a backfill, is summarised over several rounds.
+	remaining := batchTasks
+	for len(remaining) > 0 {
+		var round []queuedTask
+		round, remaining = splitSummaryRound(remaining)
+
+		if !summariseRound(ctx, round, summarizer) {
+			for _, queued := range remaining {
+				if err := returnSummaryTask(context.WithoutCancel(ctx), queued); err != nil {
+					log.Printf("Error returning task %s to the stream: %v\n", queued.messageID, err)
+				}
 			}
+			return
+		}
+	}
+}
+
+// splitSummaryRound takes the first task of each user for this round and
+// leaves the rest for later ones.
+func splitSummaryRound(tasks []queuedTask) ([]queuedTask, []queuedTask) {
+	round := []queuedTask{}
+	rest := []queuedTask{}
+	users := make(map[uint]bool)
+
+	for _, queued := range tasks {
+		if users[queued.task.UserID] {
+			rest = append(rest, queued)
 			continue
 		}
+		users[queued.task.UserID] = true
+		round = append(round, queued)
+	}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("x-api-key", SUMMARISER_KEY)
+	return round, rest
+}
 
-		client := &http.Client{
-			Timeout: 120 * time.Second, // Increased timeout for larger batches
+// summariseRound summarises tasks for distinct users and saves each summary
+// under the week its task was queued for. It returns false if the round was
+// cut off by shutdown, in which case its tasks were put back on the stream.
+func summariseRound(ctx context.Context, batchTasks []queuedTask, summarizer Summarizer) bool {
+	db := initialisers.DB
+	// Bookkeeping on the queue has to happen even once the batch has been cut off.
+	queueCtx := context.WithoutCancel(ctx)
+
+	userEntries := make(map[uint]SummaryInput)
+	for _, queued := range batchTasks {
+		moods := queued.task.Moods
+		if moods == nil {
+			moods = []models.MoodPoint{}
 		}
+		userEntries[queued.task.UserID] = SummaryInput{Entries: queued.task.Entries, Moods: moods}
+	}
 
-		log.Println("SENDING REQUEST TO SUMMARY SERVICE")
-		resp, err := client.Do(req)
+	log.Println("SENDING BATCH TO SUMMARISER")
+	result, err := summarizer.Summarize(ctx, userEntries)
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("Shutting down, returning %d summary tasks to the stream\n", len(batchTasks))
+			for _, queued := range batchTasks {
+				if err := returnSummaryTask(queueCtx, queued); err != nil {
+					// Still pending, so it will be claimed once it has been idle long enough.
+					log.Printf("Error returning task %s to the stream: %v\n", queued.messageID, err)
+				}
+			}
+			return false
+		}
 
+		log.Printf("Error summarising batch: %v\n", err)
+		for _, queued := range batchTasks {
+			failTask(queueCtx, queued, err)
+		}
+		return true
+	}
+
+	log.Println("SAVING SUMMARIES")
+	failed := 0
+	for _, queued := range batchTasks {
+		userID := queued.task.UserID
+		summary, ok := result[userID]
+		if !ok {
+			log.Printf("Summariser returned no summary for user %d\n", userID)
+			failTask(queueCtx, queued, errors.New("summariser returned no summary"))
+			failed++
+			continue
+		}
+
+		encryptedSummary, err := models.Encrypt(summary)
 		if err != nil {
-			log.Printf("Error sending data to Express server: %v\n", err)
-			// Put tasks back in the queue
-			for _, task := range batchTasks {
-				taskJSON, _ := json.Marshal(task)
-				redisClient.RPush(ctx, queueName, taskJSON)
-			}
+			log.Printf("Error encrypting summary for user %d: %v\n", userID, err)
+			failTask(queueCtx, queued, err)
+			failed++
 			continue
 		}
-		defer resp.Body.Close()
 
-		var result map[uint]string
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			log.Printf("Error decoding response from Express server: %v\n", err)
-			// Put tasks back in the queue
-			for _, task := range batchTasks {
-				taskJSON, _ := json.Marshal(task)
-				redisClient.RPush(ctx, queueName, taskJSON)
-			}
+		year, week := summaryTaskWeek(queued.task)
+		newSummary := models.Summary{
+			UserID:     userID,
+			WeekNumber: uint(week),
+			Year:       uint(year),
+			Summary:    encryptedSummary,
+		}
+
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "week_number"}, {Name: "year"}},
+			DoUpdates: clause.AssignmentColumns([]string{"summary"}),
+		}).Create(&newSummary).Error; err != nil {
+			log.Printf("Error saving summary for user %d: %v\n", userID, err)
+			failTask(queueCtx, queued, err)
+			failed++
 			continue
 		}
 
-		now := time.Now().UTC()
-		previousWeek := now.AddDate(0, 0, -7)
-		year, week := previousWeek.ISOWeek()
+		// Only now is the task done; until here a crash leaves it pending for another worker.
+		ackSummaryTask(queueCtx, queued.messageID)
+	}
 
-		log.Println("SAVING SUMMARIES")
-		for userID, summary := range result {
-			encryptedSummary, err := models.Encrypt(summary)
-			if err != nil {
-				log.Printf("Error encrypting summary for user %d: %v\n", userID, err)
-				continue
-			}
+	log.Printf("Processed batch of %d tasks, %d failed\n", len(batchTasks), failed)
+	return true
+}
 
-			newSummary := models.Summary{
-				UserID:     userID,
-				WeekNumber: uint(week),
-				Year:       uint(year),
-				Summary:    encryptedSummary,
-			}
+// summaryTaskWeek is the ISO year and week a task's summary is saved under.
+func summaryTaskWeek(task models.SummaryTask) (int, int) {
+	if task.Year != 0 {
+		return task.Year, task.Week
+	}
 
-			if err := db.Clauses(clause.OnConflict{
-				Columns:   []clause.Column{{Name: "user_id"}, {Name: "week_number"}, {Name: "year"}},
-				DoUpdates: clause.AssignmentColumns([]string{"summary"}),
-			}).Create(&newSummary).Error; err != nil {
-				log.Printf("Error saving summary for user %d: %v\n", userID, err)
-			}
-		}
+	// Tasks queued before they carried their week were always for the week before.
+	previousWeek := time.Now().UTC().AddDate(0, 0, -7)
+	return previousWeek.ISOWeek()
+}
+
+// shutdownGraceContext returns a context that outlives ctx by grace, so work
+// already under way when ctx is cancelled gets a chance to finish.
+func shutdownGraceContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
 
-		log.Printf("Processed batch of %d tasks successfully\n", len(batchTasks))
+	return graceCtx, func() {
+		stop()
+		cancel()
 	}
+}
 
+// failTask schedules a retry for the task and acknowledges its message. If the
+// retry could not be stored the message is left pending, to be claimed again.
+func failTask(ctx context.Context, queued queuedTask, cause error) {
+	if retryTask(ctx, queued.task, cause) {
+		ackSummaryTask(ctx, queued.messageID)
+	}
 }
@@ -0,0 +1,73 @@
+package routines
+
+import (
+	"context"
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"log"
+	"time"
+)
+
+// PurgeTrash hard-deletes entries that have been in the trash for longer than
+// the retention period. Their revisions go with them through the cascade, and
+// their attachments' files are removed from the blob store first. Drafts that
+// have not been saved for models.DraftTTL are deleted along the way. It returns
+// once ctx is cancelled.
+func PurgeTrash(ctx context.Context) {
+	log.Println("PURGE TRASH ROUTINE ACTIVE")
+	db := initialisers.DB
+
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().UTC().Add(-helper.TrashRetention())
+
+		var entryIDs []uint
+		if err := db.Unscoped().Model(&models.JournalEntry{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Pluck("id", &entryIDs).Error; err != nil {
+			log.Println("Error finding entries to purge: ", err)
+		} else if len(entryIDs) > 0 {
+			purgeEntries(entryIDs)
+		}
+
+		purgeExpiredDrafts()
+
+		select {
+		case <-ctx.Done():
+			log.Println("PURGE TRASH ROUTINE STOPPED")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeEntries(entryIDs []uint) {
+	db := initialisers.DB
+
+	if err := models.DeleteEntryAttachments(db, initialisers.BlobStore, entryIDs); err != nil {
+		log.Println("Error deleting attachments of purged entries: ", err)
+		return
+	}
+
+	result := db.Unscoped().Delete(&models.JournalEntry{}, entryIDs)
+	if result.Error != nil {
+		log.Println("Error purging trash: ", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Purged %d entries from the trash\n", result.RowsAffected)
+	}
+}
+
+// purgeExpiredDrafts deletes the drafts whose copy in Redis has expired.
+func purgeExpiredDrafts() {
+	db := initialisers.DB
+
+	result := db.Unscoped().Where("updated_at < ?", time.Now().Add(-models.DraftTTL)).Delete(&models.Draft{})
+	if result.Error != nil {
+		log.Println("Error purging expired drafts: ", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Purged %d expired drafts\n", result.RowsAffected)
+	}
+}
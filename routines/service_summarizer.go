@@ -0,0 +1,77 @@
+package routines
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ServiceSummarizer sends the whole batch to the Express summary service in a
+// single request, as {"entries": [...], "moods": [...]} per user. With
+// legacyPayload set, each user gets a plain list of entries instead, for
+// services that predate moods.
+type ServiceSummarizer struct {
+	url           string
+	apiKey        string
+	legacyPayload bool
+	client        *http.Client
+}
+
+func NewServiceSummarizer(url, apiKey string, legacyPayload bool) (*ServiceSummarizer, error) {
+	if url == "" {
+		return nil, errors.New("SUMMARY_SERVICE_URL is not set")
+	}
+
+	return &ServiceSummarizer{
+		url:           url,
+		apiKey:        apiKey,
+		legacyPayload: legacyPayload,
+		client: &http.Client{
+			Timeout: 120 * time.Second, // Increased timeout for larger batches
+		},
+	}, nil
+}
+
+func (s *ServiceSummarizer) Summarize(ctx context.Context, inputs map[uint]SummaryInput) (map[uint]string, error) {
+	var body any = inputs
+	if s.legacyPayload {
+		userEntries := make(map[uint][]string, len(inputs))
+		for userID, input := range inputs {
+			userEntries[userID] = input.Entries
+		}
+		body = userEntries
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.apiKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("summary service returned %s", resp.Status)
+	}
+
+	var result map[uint]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package routines
+
+import (
+	"context"
+	"daily-150/models"
+	"fmt"
+	"os"
+)
+
+// What a summariser receives for each user: the week's entries as plain text
+// and the mood ratings given on those days.
+type SummaryInput struct {
+	Entries []string           `json:"entries"`
+	Moods   []models.MoodPoint `json:"moods"`
+}
+
+// A Summarizer turns a batch of users' weeks into one summary per user, keyed
+// by user ID. An error means none of the batch was summarised and the tasks
+// should be tried again.
+type Summarizer interface {
+	Summarize(ctx context.Context, inputs map[uint]SummaryInput) (map[uint]string, error)
+}
+
+// NewSummarizer picks the summariser named by SUMMARISER: "openai" for an
+// OpenAI-compatible chat endpoint such as a local Ollama, "extractive" for the
+// in-process one that needs no network, and the summary service otherwise.
+// SUMMARY_SERVICE_LEGACY_PAYLOAD=true sends the service entries without moods.
+func NewSummarizer() (Summarizer, error) {
+	switch os.Getenv("SUMMARISER") {
+	case "", "service":
+		return NewServiceSummarizer(os.Getenv("SUMMARY_SERVICE_URL"), os.Getenv("SUMMARISER_KEY"), os.Getenv("SUMMARY_SERVICE_LEGACY_PAYLOAD") == "true")
+	case "openai":
+		return NewOpenAISummarizer(os.Getenv("SUMMARY_LLM_URL"), os.Getenv("SUMMARY_LLM_MODEL"), os.Getenv("SUMMARY_LLM_KEY"))
+	case "extractive":
+		return NewExtractiveSummarizer(defaultSummarySentences), nil
+	default:
+		return nil, fmt.Errorf("unknown SUMMARISER %q", os.Getenv("SUMMARISER"))
+	}
+}
@@ -0,0 +1,256 @@
+package routines
+
+import (
+	"context"
+	"daily-150/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func rating(n float64) *float64 {
+	return &n
+}
+
+func TestExtractiveSummarizer(t *testing.T) {
+	inputs := map[uint]SummaryInput{
+		1: {
+			Entries: []string{
+				"Went climbing with Sam at the bouldering gym. The climbing gym was packed tonight. Ok.",
+				"Finished the quarterly report at work.\nClimbing again after work, my climbing is getting better.",
+				"Baked bread for the first time and it came out flat.",
+			},
+			Moods: []models.MoodPoint{
+				{Date: "2024-05-06", Mood: rating(4), Energy: rating(3)},
+				{Date: "2024-05-07", Mood: rating(2)},
+				{Date: "2024-05-08"},
+			},
+		},
+		2: {Entries: []string{"Short.", "Too short too."}},
+	}
+
+	summarizer := NewExtractiveSummarizer(2)
+	got, err := summarizer.Summarize(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("Summarize: %v", err)
+	}
+
+	want := map[uint]string{
+		// The sentences sharing the most words with the rest, in the order they were written.
+		1: "The climbing gym was packed tonight. Climbing again after work, my climbing is getting better. " +
+			"Mood averaged 3.0 out of 5 and energy averaged 3.0 out of 5.",
+		2: "Not much was written this week.",
+	}
+	for userID, summary := range want {
+		if got[userID] != summary {
+			t.Errorf("summary for user %d = %q, want %q", userID, got[userID], summary)
+		}
+	}
+
+	for range 5 {
+		again, err := summarizer.Summarize(context.Background(), inputs)
+		if err != nil {
+			t.Fatalf("Summarize: %v", err)
+		}
+		if again[1] != got[1] || again[2] != got[2] {
+			t.Fatalf("Summarize is not deterministic: %q then %q", got, again)
+		}
+	}
+}
+
+func TestExtractiveSummarizerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewExtractiveSummarizer(3).Summarize(ctx, map[uint]SummaryInput{1: {Entries: []string{"a"}}}); err == nil {
+		t.Fatal("Summarize with a cancelled context succeeded")
+	}
+}
+
+func TestOpenAISummarizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request = %s %s, want POST /v1/chat/completions", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+
+		var request chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		if request.Model != "llama3.1" || len(request.Messages) != 2 || request.Messages[0].Role != "system" {
+			t.Errorf("unexpected request %+v", request)
+		}
+
+		prompt := request.Messages[1].Content
+		for _, part := range []string{"Entry 1:\nFirst entry", "Entry 2:\nSecond entry", "- 2024-05-06: mood 4, energy not given"} {
+			if !strings.Contains(prompt, part) {
+				t.Errorf("prompt %q does not contain %q", prompt, part)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"  You had a good week.\n"}}]}`)
+	}))
+	defer server.Close()
+
+	summarizer, err := NewOpenAISummarizer(server.URL+"/v1/", "llama3.1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := summarizer.Summarize(context.Background(), map[uint]SummaryInput{
+		7: {
+			Entries: []string{"First entry", "Second entry"},
+			Moods:   []models.MoodPoint{{Date: "2024-05-06", Mood: rating(4)}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Summarize: %v", err)
+	}
+	if got[7] != "You had a good week." {
+		t.Errorf("summary = %q", got[7])
+	}
+}
+
+func TestOpenAISummarizerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, `{"error":"overloaded"}`},
+		{"no choices", http.StatusOK, `{"choices":[]}`},
+		{"invalid json", http.StatusOK, `not json`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			summarizer, err := NewOpenAISummarizer(server.URL, "model", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := summarizer.Summarize(context.Background(), map[uint]SummaryInput{1: {Entries: []string{"entry"}}}); err == nil {
+				t.Fatal("Summarize succeeded")
+			}
+		})
+	}
+}
+
+func TestServiceSummarizer(t *testing.T) {
+	inputs := map[uint]SummaryInput{
+		3: {
+			Entries: []string{"one", "two"},
+			Moods:   []models.MoodPoint{{Date: "2024-05-06", Energy: rating(5)}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		legacyPayload bool
+		want          string
+	}{
+		{"with moods", false, `{"3":{"entries":["one","two"],"moods":[{"date":"2024-05-06","energy":5}]}}`},
+		{"legacy entries only", true, `{"3":["one","two"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if key := r.Header.Get("x-api-key"); key != "service-key" {
+					t.Errorf("x-api-key = %q", key)
+				}
+				if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+					t.Errorf("Content-Type = %q", contentType)
+				}
+
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != tt.want {
+					t.Errorf("payload = %s, want %s", body, tt.want)
+				}
+
+				io.WriteString(w, `{"3":"A quiet week."}`)
+			}))
+			defer server.Close()
+
+			summarizer, err := NewServiceSummarizer(server.URL, "service-key", tt.legacyPayload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := summarizer.Summarize(context.Background(), inputs)
+			if err != nil {
+				t.Fatalf("Summarize: %v", err)
+			}
+			if got[3] != "A quiet week." {
+				t.Errorf("summary = %q", got[3])
+			}
+		})
+	}
+}
+
+func TestServiceSummarizerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	summarizer, err := NewServiceSummarizer(server.URL, "key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := summarizer.Summarize(context.Background(), map[uint]SummaryInput{1: {Entries: []string{"entry"}}}); err == nil {
+		t.Fatal("Summarize succeeded")
+	}
+}
+
+func TestNewSummarizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"default is the service", map[string]string{"SUMMARY_SERVICE_URL": "http://localhost:3001"}, "*routines.ServiceSummarizer", false},
+		{"service", map[string]string{"SUMMARISER": "service", "SUMMARY_SERVICE_URL": "http://localhost:3001"}, "*routines.ServiceSummarizer", false},
+		{"service without url", map[string]string{"SUMMARISER": "service"}, "", true},
+		{"openai", map[string]string{"SUMMARISER": "openai", "SUMMARY_LLM_URL": "http://localhost:11434/v1", "SUMMARY_LLM_MODEL": "llama3.1"}, "*routines.OpenAISummarizer", false},
+		{"openai without model", map[string]string{"SUMMARISER": "openai", "SUMMARY_LLM_URL": "http://localhost:11434/v1"}, "", true},
+		{"extractive", map[string]string{"SUMMARISER": "extractive"}, "*routines.ExtractiveSummarizer", false},
+		{"unknown", map[string]string{"SUMMARISER": "magic"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SUMMARISER", "SUMMARY_SERVICE_URL", "SUMMARY_LLM_URL", "SUMMARY_LLM_MODEL"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			summarizer, err := NewSummarizer()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewSummarizer() = %T, want an error", summarizer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSummarizer: %v", err)
+			}
+			if got := fmt.Sprintf("%T", summarizer); got != tt.want {
+				t.Errorf("NewSummarizer() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
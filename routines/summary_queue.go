@@ -0,0 +1,242 @@
+package routines
+
+import (
+	"context"
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Tasks waiting to be summarised. Every worker reads it through the same
+	// consumer group, so each task goes to one worker and stays pending until
+	// that worker acknowledges it.
+	SummaryStream = "summary_tasks:stream"
+	SummaryGroup  = "summary_workers"
+	// Failed tasks waiting for their next attempt, scored by when it is due in Unix milliseconds.
+	SummaryRetryQueue = "summary_tasks:retry"
+	// Tasks that failed too many times and are left for an admin to look at.
+	SummaryDeadQueue = "summary_tasks:dead"
+
+	// The list tasks were queued on before the stream, drained into it at startup.
+	legacySummaryQueue = "summary_tasks"
+
+	// The stream field a task's JSON is stored under.
+	summaryTaskField = "task"
+)
+
+// How many due retries are moved back onto the stream at a time.
+const retryPromoteLimit = 100
+
+// Moves due retries back onto the stream. Each task is removed from the sorted
+// set and added in the same script, so no task is lost or doubled when several
+// workers promote at once.
+var promoteRetriesScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, task in ipairs(due) do
+	redis.call('ZREM', KEYS[1], task)
+	redis.call('XADD', KEYS[2], '*', ARGV[3], task)
+end
+return #due
+`)
+
+var drainLegacyQueueScript = redis.NewScript(`
+local moved = 0
+local task = redis.call('LPOP', KEYS[1])
+while task do
+	redis.call('XADD', KEYS[2], '*', ARGV[1], task)
+	moved = moved + 1
+	task = redis.call('LPOP', KEYS[1])
+end
+return moved
+`)
+
+// EnqueueSummaryTask adds a task to the stream for the next free worker.
+func EnqueueSummaryTask(ctx context.Context, task models.SummaryTask) error {
+	taskJSON, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	return initialisers.RedisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: SummaryStream,
+		Values: map[string]any{summaryTaskField: taskJSON},
+	}).Err()
+}
+
+// setUpSummaryStream creates the consumer group if this is the first worker to
+// start, and moves anything still queued on the old list onto the stream.
+func setUpSummaryStream(ctx context.Context) error {
+	redisClient := initialisers.RedisClient
+
+	err := redisClient.XGroupCreateMkStream(ctx, SummaryStream, SummaryGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	moved, err := drainLegacyQueueScript.Run(ctx, redisClient,
+		[]string{legacySummaryQueue, SummaryStream}, summaryTaskField).Int()
+	if err != nil {
+		return err
+	}
+	if moved > 0 {
+		log.Printf("Moved %d summary tasks from %s to %s\n", moved, legacySummaryQueue, SummaryStream)
+	}
+	return nil
+}
+
+// summaryConsumerName identifies this process within the consumer group.
+// SUMMARY_CONSUMER_NAME overrides it; by default it is the host name and
+// process ID, which is unique for each server instance.
+func summaryConsumerName() string {
+	if name := os.Getenv("SUMMARY_CONSUMER_NAME"); name != "" {
+		return name
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// ackSummaryTask acknowledges a message once its task has been dealt with and
+// removes it from the stream so the stream does not grow forever.
+func ackSummaryTask(ctx context.Context, messageID string) {
+	redisClient := initialisers.RedisClient
+
+	if _, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, SummaryStream, SummaryGroup, messageID)
+		pipe.XDel(ctx, SummaryStream, messageID)
+		return nil
+	}); err != nil {
+		log.Printf("Error acknowledging summary task %s: %v\n", messageID, err)
+	}
+}
+
+// returnSummaryTask puts a task that was read but not finished back on the
+// stream for another worker, without counting it as a failed attempt.
+func returnSummaryTask(ctx context.Context, queued queuedTask) error {
+	taskJSON, err := json.Marshal(queued.task)
+	if err != nil {
+		return err
+	}
+
+	_, err = initialisers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: SummaryStream,
+			Values: map[string]any{summaryTaskField: taskJSON},
+		})
+		pipe.XAck(ctx, SummaryStream, SummaryGroup, queued.messageID)
+		pipe.XDel(ctx, SummaryStream, queued.messageID)
+		return nil
+	})
+	return err
+}
+
+// promoteDueRetries puts tasks whose retry delay has passed back onto the stream.
+func promoteDueRetries(ctx context.Context) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	promoted, err := promoteRetriesScript.Run(ctx, initialisers.RedisClient,
+		[]string{SummaryRetryQueue, SummaryStream}, now, retryPromoteLimit, summaryTaskField).Int()
+	if err != nil {
+		log.Println("Error promoting summary retries: ", err)
+		return
+	}
+	if promoted > 0 {
+		log.Printf("Requeued %d summary tasks for another attempt\n", promoted)
+	}
+}
+
+// retryTask records a failed attempt and schedules the task to be tried again
+// after a backoff, or moves it to the dead-letter queue once it has used up
+// its attempts. It returns false if the task could not be stored anywhere, in
+// which case its message must stay pending so it is not lost.
+func retryTask(ctx context.Context, task models.SummaryTask, cause error) bool {
+	redisClient := initialisers.RedisClient
+
+	now := time.Now().UTC()
+	task.Attempts++
+	task.LastError = cause.Error()
+	task.FailedAt = &now
+
+	taskJSON, err := json.Marshal(task)
+	if err != nil {
+		log.Printf("Error marshalling task for user %d: %v\n", task.UserID, err)
+		return false
+	}
+
+	if task.Attempts >= helper.SummaryMaxAttempts() {
+		log.Printf("Summary task for user %d failed %d times, moving it to %s\n", task.UserID, task.Attempts, SummaryDeadQueue)
+		if err := redisClient.RPush(ctx, SummaryDeadQueue, taskJSON).Err(); err != nil {
+			log.Printf("Error moving task for user %d to dead-letter queue: %v\n", task.UserID, err)
+			return false
+		}
+		return true
+	}
+
+	due := now.Add(helper.SummaryRetryDelay(task.Attempts))
+	if err := redisClient.ZAdd(ctx, SummaryRetryQueue, redis.Z{
+		Score:  float64(due.UnixMilli()),
+		Member: taskJSON,
+	}).Err(); err != nil {
+		log.Printf("Error scheduling retry for user %d: %v\n", task.UserID, err)
+		return false
+	}
+	return true
+}
+
+// RequeueDeadTasks moves dead tasks back onto the stream with their attempts
+// reset. With userID set only that user's tasks are moved. It returns how many
+// tasks were requeued.
+func RequeueDeadTasks(ctx context.Context, userID *uint) (int, error) {
+	redisClient := initialisers.RedisClient
+
+	dead, err := redisClient.LRange(ctx, SummaryDeadQueue, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, taskJSON := range dead {
+		var task models.SummaryTask
+		if err := json.Unmarshal([]byte(taskJSON), &task); err != nil {
+			log.Println("Error unmarshalling dead task: ", err)
+			continue
+		}
+		if userID != nil && task.UserID != *userID {
+			continue
+		}
+
+		// Another admin request may have requeued it already.
+		removed, err := redisClient.LRem(ctx, SummaryDeadQueue, 1, taskJSON).Result()
+		if err != nil {
+			return requeued, err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		task.Attempts = 0
+		task.LastError = ""
+		task.FailedAt = nil
+
+		if err := EnqueueSummaryTask(ctx, task); err != nil {
+			// Leave it where it was rather than lose it.
+			redisClient.RPush(ctx, SummaryDeadQueue, taskJSON)
+			return requeued, err
+		}
+		requeued++
+	}
+
+	return requeued, nil
+}
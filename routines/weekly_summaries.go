@@ -0,0 +1,107 @@
+package routines
+
+import (
+	"context"
+	"daily-150/helper"
+	"daily-150/initialisers"
+	"daily-150/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// LastWeekStarts groups the time zones users are in by the Monday of the last
+// week that has ended there at now. Zones behind UTC can still be in a week
+// that has ended in UTC.
+func LastWeekStarts(now time.Time) (map[time.Time][]string, error) {
+	var zones []string
+	if err := initialisers.DB.Model(&models.User{}).Distinct().Pluck("time_zone", &zones).Error; err != nil {
+		return nil, err
+	}
+
+	weeks := make(map[time.Time][]string)
+	for _, zone := range zones {
+		week := models.WeekStart(models.CalendarDate(now, models.User{TimeZone: zone}.Location())).AddDate(0, 0, -7)
+		weeks[week] = append(weeks[week], zone)
+	}
+	return weeks, nil
+}
+
+// EnqueueWeekSummaries queues a summary task for every user in one of
+// timeZones who wrote in the week starting on weekStart, a Monday. A userID of
+// 0 means every such user. With skipExisting, users who already have a summary
+// for that week are left out. It returns how many tasks were queued.
+func EnqueueWeekSummaries(ctx context.Context, weekStart time.Time, timeZones []string, userID uint, skipExisting bool) (int, error) {
+	db := initialisers.DB
+	redisClient := initialisers.RedisClient
+
+	weekEnd := weekStart.AddDate(0, 0, 6)
+	year, week := weekStart.ISOWeek()
+
+	// entry_date is already the user's local day, so every user's week runs Monday to Monday in their own zone.
+	// Notebooks the user keeps out of summaries are skipped.
+	query := db.Where("entry_date >= ? AND entry_date <= ?", weekStart, weekEnd).
+		Where("notebook_id IN (?)", db.Model(&models.Notebook{}).Select("id").Where("include_in_summary")).
+		Where("user_id IN (?)", db.Model(&models.User{}).Select("id").Where("time_zone IN ?", timeZones))
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if skipExisting {
+		query = query.Where("user_id NOT IN (?)", db.Model(&models.Summary{}).Select("user_id").Where("year = ? AND week_number = ?", year, week))
+	}
+
+	var entries []models.JournalEntry
+	if err := query.Order("entry_date ASC").Find(&entries).Error; err != nil {
+		return 0, err
+	}
+
+	log.Println("GOT THESE MANY ENTRIES: ", len(entries))
+	log.Println("DECRYPTING ENTRIES")
+
+	userEntries := make(map[uint][]string)
+	userMoods := make(map[uint][]models.JournalEntry)
+	for _, entry := range entries {
+		decryptedContent, err := models.Decrypt(entry.EncryptedContent)
+
+		if err != nil {
+			continue
+		}
+
+		userEntries[entry.UserID] = append(userEntries[entry.UserID], helper.MarkdownToText(decryptedContent))
+		userMoods[entry.UserID] = append(userMoods[entry.UserID], entry)
+	}
+
+	taskCount := 0
+	for userID, entries := range userEntries {
+		task := models.SummaryTask{
+			UserID:    userID,
+			Entries:   entries,
+			Moods:     models.MoodPoints(userMoods[userID]),
+			WeekStart: weekStart.Format("2006-01-02"),
+			WeekEnd:   weekEnd.Format("2006-01-02"),
+			Year:      year,
+			Week:      week,
+		}
+
+		log.Println("PUSHING TASK INTO QUEUE ")
+
+		if err := EnqueueSummaryTask(ctx, task); err != nil {
+			log.Println("Error pushing task to Redis queue: ", err)
+			continue
+		}
+		taskCount++
+	}
+
+	batchInfoJSON, _ := json.Marshal(map[string]interface{}{
+		"year":      year,
+		"week":      week,
+		"taskCount": taskCount,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+
+	log.Println("SETTING REDIS BATCH INFO")
+	redisClient.Set(ctx, fmt.Sprintf("batch:%d:%d", year, week), batchInfoJSON, 30*24*time.Hour)
+
+	return taskCount, nil
+}
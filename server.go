@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"daily-150/initialisers"
 	"daily-150/middlewares"
 	"daily-150/migrate"
@@ -8,7 +9,11 @@ import (
 	"daily-150/routines"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -21,32 +26,81 @@ func init() {
 	initialisers.LoadEnv()
 	initialisers.ConnectDB()
 	initialisers.InitRedis()
+	initialisers.InitBlobStore()
 	migrate.RunMigrations()
 }
 
-func main() {
-
-	go routines.ProcessSummaries()
+// How long shutdown waits for open requests and in-flight summary batches.
+const shutdownTimeout = 30 * time.Second
 
-	app := fiber.New()
+func main() {
+	// Cancelled on SIGINT or SIGTERM, which starts the shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var routinesDone sync.WaitGroup
+	routinesDone.Add(2)
+	go func() {
+		defer routinesDone.Done()
+		routines.ProcessSummaries(ctx)
+	}()
+	go func() {
+		defer routinesDone.Done()
+		routines.PurgeTrash(ctx)
+	}()
+
+	app := fiber.New(fiber.Config{
+		// Attachments are read from the connection as they arrive rather than
+		// buffered, so body sizes are checked by middlewares.LimitBody instead.
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
 
 	setupMiddlewares(app)
 	setupRoutes(app)
 	setupStaticFiles(app)
-	startServer(app)
+	go startServer(app)
 
+	<-ctx.Done()
+	shutdown(app, &routinesDone)
+}
+
+// shutdown stops taking requests, lets open ones finish, and waits for the
+// background routines to wrap up, all within shutdownTimeout.
+func shutdown(app *fiber.App, routinesDone *sync.WaitGroup) {
+	log.Println("SHUTTING DOWN")
+	deadline := time.Now().Add(shutdownTimeout)
+
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		log.Println("Error shutting down server:", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		routinesDone.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("SHUTDOWN COMPLETE")
+	case <-time.After(time.Until(deadline)):
+		log.Println("Timed out waiting for background routines to stop")
+	}
 }
 
 func setupMiddlewares(app *fiber.App) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000,http://localhost:5173,http://localhost:8080, chrome-extension://jlmohemkiclhpibllpcbggcdopblnodn",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, Upgrade, Connection, Sec-WebSocket-Key, Sec-WebSocket-Version, Sec-WebSocket-Extensions, Sec-WebSocket-Protocol",
-		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, If-Match, Upgrade, Connection, Sec-WebSocket-Key, Sec-WebSocket-Version, Sec-WebSocket-Extensions, Sec-WebSocket-Protocol",
+		AllowMethods:     "GET, POST, PUT, PATCH, DELETE, OPTIONS",
 		AllowCredentials: true,
 		MaxAge:           3600,
-		ExposeHeaders:    "Set-Cookie",
+		ExposeHeaders:    "Set-Cookie, ETag",
 	}))
 
+	app.Use(middlewares.LimitBody(fiber.DefaultBodyLimit))
+
 	cookieEncryptionKey := os.Getenv("COOKIE_ENCRYPTION_KEY")
 	if cookieEncryptionKey == "" {
 		log.Fatalln("COOKIE_ENCRYPTION_KEY is not set")
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps opaque binary objects under string keys. Keys use "/" as a
+// separator. Implementations do not encrypt anything themselves; callers hand
+// them data that is already encrypted.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns ErrBlobNotFound when there is nothing stored under key.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete succeeds when there is nothing stored under key.
+	Delete(ctx context.Context, key string) error
+}
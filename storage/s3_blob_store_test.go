@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "eu-west-1"
+)
+
+// fakeS3 is a minimal S3 endpoint that keeps objects in memory and refuses
+// requests whose Signature Version 4 signature it cannot reproduce.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := verifySignature(r, body); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature recomputes the signature from the request as received,
+// following the AWS Signature Version 4 specification.
+func verifySignature(r *http.Request, body []byte) error {
+	amzDate := r.Header.Get("x-amz-date")
+	when, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return errors.New("missing or malformed x-amz-date")
+	}
+	if time.Since(when).Abs() > 15*time.Minute {
+		return errors.New("request time too skewed")
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	if r.Header.Get("x-amz-content-sha256") != payloadHash {
+		return errors.New("payload hash does not match body")
+	}
+
+	day := amzDate[:8]
+	scope := day + "/" + testRegion + "/s3/aws4_request"
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" +
+		payloadHash
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{day, testRegion, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + signature
+	if !hmac.Equal([]byte(r.Header.Get("Authorization")), []byte(want)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func newTestS3(t *testing.T, endpointPath string) (*S3BlobStore, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3BlobStore(server.URL+endpointPath, "journal", testRegion, testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, fake
+}
+
+func TestS3BlobStoreRoundTrip(t *testing.T) {
+	for _, endpointPath := range []string{"", "/", "/minio"} {
+		t.Run("endpoint path "+endpointPath, func(t *testing.T) {
+			store, fake := newTestS3(t, endpointPath)
+			ctx := context.Background()
+			key := "attachments/7/0123456789abcdef"
+			data := []byte("encrypted bytes\x00\xff")
+
+			if err := store.Put(ctx, key, data); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			got, err := store.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if string(got) != string(data) {
+				t.Fatalf("Get = %q, want %q", got, data)
+			}
+
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+				t.Fatalf("Get after Delete = %v, want ErrBlobNotFound", err)
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete of missing blob: %v", err)
+			}
+
+			wantPath := strings.TrimSuffix(endpointPath, "/") + "/journal/" + key
+			if first := fake.requests[0]; first != "PUT "+wantPath {
+				t.Errorf("first request = %q, want %q", first, "PUT "+wantPath)
+			}
+		})
+	}
+}
+
+func TestS3BlobStoreEmptyBlob(t *testing.T) {
+	store, _ := newTestS3(t, "")
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "empty", nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := store.Get(ctx, "empty")
+	if err != nil || len(got) != 0 {
+		t.Fatalf("Get = %q, %v, want empty", got, err)
+	}
+}
+
+func TestS3BlobStoreRejectedSignature(t *testing.T) {
+	store, _ := newTestS3(t, "")
+	store.SecretKey = "wrong"
+
+	err := store.Put(context.Background(), "key", []byte("data"))
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Put with wrong secret = %v, want a 403 error", err)
+	}
+}
+
+func TestS3BlobStoreSignatureIsStable(t *testing.T) {
+	store, err := NewS3BlobStore("https://s3.example.com", "journal", testRegion, testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://s3.example.com/journal/key", nil)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.sign(req, nil, now)
+
+	if got := req.Header.Get("x-amz-date"); got != "20240501T120000Z" {
+		t.Errorf("x-amz-date = %q", got)
+	}
+	if got := req.Header.Get("x-amz-content-sha256"); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("x-amz-content-sha256 = %q, want the hash of an empty body", got)
+	}
+
+	first := req.Header.Get("Authorization")
+	store.sign(req, nil, now)
+	if again := req.Header.Get("Authorization"); again != first {
+		t.Errorf("signing twice gave %q and %q", first, again)
+	}
+	if !strings.HasPrefix(first, "AWS4-HMAC-SHA256 Credential="+testAccessKey+"/20240501/"+testRegion+"/s3/aws4_request, ") {
+		t.Errorf("Authorization = %q", first)
+	}
+}